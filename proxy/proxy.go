@@ -0,0 +1,184 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package proxy implements a Twister request handler that forwards requests
+// to a backend HTTP server.
+//
+// The handler is registered like any other handler:
+//
+//  r.Register("/api/<:.*>", "*", proxy.ReverseProxyHandler("http://localhost:8081"))
+package proxy
+
+import (
+	"github.com/garyburd/twister/web"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// hopHeaders are the hop-by-hop headers removed from forwarded requests and
+// responses.
+var hopHeaders = []string{
+	web.HeaderConnection,
+	web.HeaderKeepAlive,
+	web.HeaderProxyAuthenticate,
+	web.HeaderProxyAuthorization,
+	web.HeaderTE,
+	web.HeaderTrailer,
+	web.HeaderTransferEncoding,
+	web.HeaderUpgrade,
+}
+
+// removeHopHeaders removes the hop-by-hop headers and the headers named in
+// the Connection header from header.
+func removeHopHeaders(header web.Header) {
+	for _, key := range header.GetList(web.HeaderConnection) {
+		header.Delete(web.HeaderName(key))
+	}
+	for _, key := range hopHeaders {
+		header.Delete(key)
+	}
+}
+
+// ReverseProxyHandler returns a handler that forwards requests to the HTTP
+// server at target. The request path is appended to the target path and the
+// request query is combined with the target query. The method, header and
+// body are copied to the backend request with the hop-by-hop headers
+// removed. The client's IP address is appended to the X-Forwarded-For
+// header.
+//
+// The response status, header and body from the backend are copied to the
+// response with the hop-by-hop headers removed. If the length of the backend
+// response body is not known, then the response is flushed after each write.
+// If the backend cannot be reached, then the handler responds with status 502.
+//
+// ReverseProxyHandler panics if target is not an absolute URL.
+func ReverseProxyHandler(target string) web.Handler {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		panic("twister: invalid reverse proxy target " + target)
+	}
+	return &reverseProxyHandler{target: u, transport: http.DefaultTransport}
+}
+
+type reverseProxyHandler struct {
+	target    *url.URL
+	transport http.RoundTripper
+}
+
+// outURL returns the backend URL for the request.
+func (h *reverseProxyHandler) outURL(req *web.Request) *url.URL {
+	u := *h.target
+	switch {
+	case strings.HasSuffix(u.Path, "/") && strings.HasPrefix(req.URL.Path, "/"):
+		u.Path += req.URL.Path[1:]
+	case u.Path == "" || strings.HasSuffix(u.Path, "/") || strings.HasPrefix(req.URL.Path, "/"):
+		u.Path += req.URL.Path
+	default:
+		u.Path += "/" + req.URL.Path
+	}
+	switch {
+	case u.RawQuery == "":
+		u.RawQuery = req.URL.RawQuery
+	case req.URL.RawQuery != "":
+		u.RawQuery += "&" + req.URL.RawQuery
+	}
+	return &u
+}
+
+func (h *reverseProxyHandler) ServeWeb(req *web.Request) {
+	header := make(web.Header, len(req.Header))
+	for key, values := range req.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	removeHopHeaders(header)
+	header.Delete(web.HeaderHost)
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if prior := header.GetList(web.HeaderXForwardedFor); len(prior) > 0 {
+		ip = strings.Join(prior, ", ") + ", " + ip
+	}
+	header.Set(web.HeaderXForwardedFor, ip)
+
+	outReq := &http.Request{
+		Method:        req.Method,
+		URL:           h.outURL(req),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(header),
+		Host:          h.target.Host,
+		ContentLength: int64(req.ContentLength),
+	}
+	if req.ContentLength != 0 && req.Body != nil {
+		outReq.Body = nopCloser{req.Body}
+	}
+
+	resp, err := h.transport.RoundTrip(outReq)
+	if err != nil {
+		req.Error(web.StatusBadGateway, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	respHeader := web.Header(resp.Header)
+	removeHopHeaders(respHeader)
+	w := req.Responder.Respond(resp.StatusCode, respHeader)
+	if f, ok := w.(web.Flusher); ok && streaming(resp) {
+		w = flushWriter{w, f}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Println("twister: reverse proxy copy failed,", err)
+	}
+}
+
+// streaming returns true if the length of the backend response body is not
+// known in advance. Streamed responses such as server-sent events are flushed
+// to the client as the data arrives from the backend.
+func streaming(resp *http.Response) bool {
+	if resp.ContentLength < 0 {
+		return true
+	}
+	for _, te := range resp.TransferEncoding {
+		if te == "chunked" {
+			return true
+		}
+	}
+	return false
+}
+
+// flushWriter flushes the response body after each write.
+type flushWriter struct {
+	w io.Writer
+	f web.Flusher
+}
+
+func (w flushWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err == nil {
+		err = w.f.Flush()
+	}
+	return n, err
+}
+
+type nopCloser struct {
+	io.Reader
+}
+
+func (nopCloser) Close() error { return nil }
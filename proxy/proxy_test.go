@@ -0,0 +1,153 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package proxy
+
+import (
+	"github.com/garyburd/twister/web"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReverseProxyHandler(t *testing.T) {
+	var backendReq *http.Request
+	var backendBody string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendReq = r
+		p, _ := ioutil.ReadAll(r.Body)
+		backendBody = string(p)
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Result", "ok")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	}))
+	defer backend.Close()
+
+	h := ReverseProxyHandler(backend.URL + "/base/")
+	header := web.NewHeader(
+		web.HeaderConnection, "keep-alive, X-Hop",
+		web.HeaderKeepAlive, "timeout=10",
+		web.HeaderTE, "trailers",
+		web.HeaderTrailer, "X-Checksum",
+		"X-Hop", "1",
+		"X-Custom", "value",
+		web.HeaderXForwardedFor, "5.6.7.8",
+		web.HeaderContentLength, "5")
+	status, respHeader, body := web.RunHandler("http://example.com/items?a=1", "POST", header, []byte("hello"), h)
+
+	if status != web.StatusCreated || string(body) != "created" {
+		t.Errorf("status=%d body=%q, want %d %q", status, body, web.StatusCreated, "created")
+	}
+	if v := respHeader.Get("X-Result"); v != "ok" {
+		t.Errorf("X-Result=%q, want ok", v)
+	}
+	if v := respHeader.Get(web.HeaderKeepAlive); v != "" {
+		t.Errorf("response Keep-Alive=%q, want removed", v)
+	}
+
+	if backendReq == nil {
+		t.Fatal("backend not called")
+	}
+	if backendReq.Method != "POST" || backendReq.URL.Path != "/base/items" || backendReq.URL.RawQuery != "a=1" {
+		t.Errorf("backend request %s %s, want POST /base/items?a=1", backendReq.Method, backendReq.URL)
+	}
+	if backendBody != "hello" {
+		t.Errorf("backend body=%q, want hello", backendBody)
+	}
+	if backendReq.Host != strings.TrimPrefix(backend.URL, "http://") {
+		t.Errorf("backend host=%q, want %q", backendReq.Host, backend.URL)
+	}
+	for _, key := range []string{web.HeaderKeepAlive, web.HeaderTE, web.HeaderTrailer, "X-Hop"} {
+		if v := backendReq.Header.Get(key); v != "" {
+			t.Errorf("backend %s=%q, want removed", key, v)
+		}
+	}
+	if v := backendReq.Header.Get("X-Custom"); v != "value" {
+		t.Errorf("backend X-Custom=%q, want value", v)
+	}
+	if v := backendReq.Header.Get(web.HeaderXForwardedFor); v != "5.6.7.8, 1.2.3.4" {
+		t.Errorf("backend X-Forwarded-For=%q, want %q", v, "5.6.7.8, 1.2.3.4")
+	}
+}
+
+func TestReverseProxyHandlerBadGateway(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	url := backend.URL
+	backend.Close()
+	status, _, _ := web.RunHandler("http://example.com/", "GET", nil, nil, ReverseProxyHandler(url))
+	if status != web.StatusBadGateway {
+		t.Errorf("status=%d, want %d", status, web.StatusBadGateway)
+	}
+}
+
+type flushResponder struct {
+	web.Responder
+	w *flushRecorder
+}
+
+func (r flushResponder) Respond(status int, header web.Header) io.Writer {
+	r.Responder.Respond(status, header)
+	return r.w
+}
+
+// flushRecorder records the body written before each flush.
+type flushRecorder struct {
+	body    []byte
+	flushed []string
+	release chan bool
+}
+
+func (w *flushRecorder) Write(p []byte) (int, error) {
+	w.body = append(w.body, p...)
+	return len(p), nil
+}
+
+func (w *flushRecorder) Flush() error {
+	if len(w.flushed) == 0 {
+		close(w.release)
+	}
+	w.flushed = append(w.flushed, string(w.body))
+	return nil
+}
+
+func TestReverseProxyHandlerStreaming(t *testing.T) {
+	w := &flushRecorder{release: make(chan bool)}
+	backend := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set(web.HeaderContentType, "text/event-stream")
+		io.WriteString(rw, "data: first\n\n")
+		rw.(http.Flusher).Flush()
+		select {
+		case <-w.release:
+		case <-time.After(2 * time.Second):
+		}
+		io.WriteString(rw, "data: second\n\n")
+	}))
+	defer backend.Close()
+
+	req, _ := web.NewTestRequest("GET", "http://example.com/events", nil, nil)
+	req.Responder = flushResponder{req.Responder, w}
+	ReverseProxyHandler(backend.URL).ServeWeb(req)
+
+	if string(w.body) != "data: first\n\ndata: second\n\n" {
+		t.Errorf("body=%q", w.body)
+	}
+	if len(w.flushed) == 0 || w.flushed[0] != "data: first\n\n" {
+		t.Errorf("flushed=%q, want first event flushed before second", w.flushed)
+	}
+}
@@ -16,6 +16,7 @@ package server
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"github.com/garyburd/twister/web"
 	"io"
@@ -143,6 +144,13 @@ func (w *identityResponseBody) Flush() error {
 	return w.err
 }
 
+// Abort causes the response to end with err.
+func (w *identityResponseBody) Abort(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
 func (w *identityResponseBody) finish() (int, error) {
 	w.Flush()
 	if w.err != nil {
@@ -166,6 +174,9 @@ type chunkedResponseBody struct {
 	n       int       // current write position in buf
 	ndigit  int       // number of hex digits in chunk size
 	written int
+
+	// Trailer fields written after the last chunk.
+	trailer web.Header
 }
 
 func newChunkedResponseBody(wr io.Writer, header []byte, bufferSize int) (*chunkedResponseBody, error) {
@@ -234,12 +245,34 @@ func (w *chunkedResponseBody) Flush() error {
 	return nil
 }
 
+// SetTrailer sets a trailer field to send after the response body.
+func (w *chunkedResponseBody) SetTrailer(key, value string) {
+	if w.trailer == nil {
+		w.trailer = make(web.Header)
+	}
+	w.trailer.Set(key, value)
+}
+
+// Abort causes the response to end with err.
+func (w *chunkedResponseBody) Abort(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
 func (w *chunkedResponseBody) finish() (int, error) {
 	if w.err != nil {
 		return w.written, w.err
 	}
 	w.finalizeChunk()
-	const last = "0\r\n\r\n"
+	last := "0\r\n\r\n"
+	if len(w.trailer) > 0 {
+		var b bytes.Buffer
+		b.WriteString("0\r\n")
+		w.trailer.WriteHttpHeaderFields(&b)
+		b.WriteString("\r\n")
+		last = b.String()
+	}
 	if w.n+len(last) > len(w.buf) {
 		w.writeBuf()
 		if w.err != nil {
@@ -247,9 +280,15 @@ func (w *chunkedResponseBody) finish() (int, error) {
 		}
 		w.n = 0
 	}
-	copy(w.buf[w.n:], last)
-	w.n += len(last)
-	w.writeBuf()
+	if len(last) > len(w.buf) {
+		var n int
+		n, w.err = io.WriteString(w.wr, last)
+		w.written += n
+	} else {
+		copy(w.buf[w.n:], last)
+		w.n += len(last)
+		w.writeBuf()
+	}
 	err := w.err
 	if w.err == nil {
 		w.err = web.ErrInvalidState
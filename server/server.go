@@ -18,6 +18,7 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"github.com/garyburd/twister/web"
 	"io"
@@ -27,9 +28,13 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var errBadRequestLine = errors.New("twister.server: could not parse request line")
+var errHTTP09 = errors.New("twister.server: HTTP/0.9 request not supported")
+var errContinueTimeout = errors.New("twister.server: timeout waiting for request body after 100 Continue")
 
 // Server defines parameters for running an HTTP server.
 type Server struct {
@@ -41,7 +46,8 @@ type Server struct {
 	// required to set this field.
 	Handler web.Handler
 
-	// If true, then set the request URL protocol to HTTPS.
+	// If true, then set the request URL protocol to HTTPS. The protocol is
+	// always set to HTTPS for connections of type *tls.Conn.
 	Secure bool
 
 	// Set request URL host to this string if host is not specified in the
@@ -53,6 +59,65 @@ type Server struct {
 
 	// If true, do not recover from handler panics.
 	NoRecoverHandlers bool
+
+	// Maximum duration of a single write to the connection. A write that does
+	// not complete before the timeout fails and the connection is closed. If
+	// zero, then writes do not time out.
+	WriteTimeout time.Duration
+
+	// Maximum duration to wait for the next request on a keep-alive
+	// connection. The connection is closed if a request does not arrive
+	// before the timeout. The timeout does not apply to reading a request
+	// after the request starts to arrive. If zero, then idle connections
+	// are not closed.
+	IdleTimeout time.Duration
+
+	// Maximum duration to wait for the request body to start arriving after
+	// the server sends the 100 Continue interim response. If the body does
+	// not start before the timeout, then reads of the request body fail and
+	// the connection is closed after the response. If zero, then the server
+	// waits indefinitely.
+	ContinueTimeout time.Duration
+
+	// If true, then respond to HTTP/0.9 simple requests with the response
+	// body only, as specified by HTTP/0.9. Otherwise, simple requests are
+	// rejected with status 400. The request ProtocolVersion is
+	// web.ProtocolVersion09 for simple requests.
+	ServeHTTP09 bool
+
+	// Non-zero when the server is draining connections.
+	draining int32
+}
+
+// SetDraining sets the server's draining mode. While draining, the server
+// responds to requests with "Connection: close" so that clients and load
+// balancers stop reusing connections to the server. In-flight requests are
+// not interrupted.
+func (s *Server) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&s.draining, v)
+}
+
+// Draining returns true if the server is in draining mode.
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) != 0
+}
+
+// HealthHandler returns a handler that reports the readiness of the server.
+// The handler responds with status 200 when the server is ready and with
+// status 503 when the server is draining.
+func (s *Server) HealthHandler() web.Handler {
+	return web.HandlerFunc(func(req *web.Request) {
+		status := web.StatusOK
+		if s.Draining() {
+			status = web.StatusServiceUnavailable
+		}
+		w := req.Respond(status, web.HeaderContentType, "text/plain; charset=utf-8")
+		io.WriteString(w, web.StatusText(status))
+	})
 }
 
 // Logger defines an interface for logging a request.
@@ -83,6 +148,7 @@ type transaction struct {
 	respondCalled      bool
 	responseErr        error
 	write100Continue   bool
+	waitForBody        bool
 	status             int
 	header             web.Header
 	headerSize         int
@@ -140,6 +206,13 @@ func readRequestLine(b *bufio.Reader) (method string, urlStr string, version int
 		return
 	}
 
+	if method == "GET" && len(p) > 0 && bytes.IndexByte(p, ' ') < 0 {
+		// HTTP/0.9 simple request.
+		urlStr = string(p)
+		version = web.ProtocolVersion09
+		return
+	}
+
 	urlStr, p, err = nextWord(p)
 	if err != nil {
 		return
@@ -177,14 +250,22 @@ func readRequestLine(b *bufio.Reader) (method string, urlStr string, version int
 }
 
 func (t *transaction) prepare() (err error) {
+	if _, err := t.br.Peek(1); err != nil {
+		return err
+	}
+	start := time.Now()
+
 	method, requestURI, version, err := readRequestLine(t.br)
 	if err != nil {
 		return err
 	}
 
 	header := web.Header{}
-	err = header.ParseHttpHeader(t.br)
-	if err != nil {
+	if version == web.ProtocolVersion09 {
+		if !t.server.ServeHTTP09 {
+			return errHTTP09
+		}
+	} else if err = header.ParseHttpHeader(t.br); err != nil {
 		return err
 	}
 
@@ -200,7 +281,7 @@ func (t *transaction) prepare() (err error) {
 		}
 	}
 
-	if t.server.Secure {
+	if _, ok := t.conn.(*tls.Conn); ok || t.server.Secure {
 		u.Scheme = "https"
 	} else {
 		u.Scheme = "http"
@@ -211,6 +292,7 @@ func (t *transaction) prepare() (err error) {
 		return
 	}
 	t.req = req
+	req.Timings().RequestStart = start
 
 	if s := req.Header.Get(web.HeaderExpect); s != "" {
 		t.write100Continue = strings.ToLower(s) == "100-continue"
@@ -255,13 +337,51 @@ func (t *transaction) checkRead() error {
 		}
 		return t.requestErr
 	}
+	if err := t.SendContinue(); err != nil {
+		return err
+	}
+	if t.waitForBody {
+		t.waitForBody = false
+		if !waitForRequest(t.conn, t.br, t.server.ContinueTimeout) {
+			t.requestErr = errContinueTimeout
+			return t.requestErr
+		}
+	}
+	return nil
+}
+
+// SendContinue writes the 100 Continue interim response if the client sent
+// "Expect: 100-continue" and the interim response was not already written.
+func (t *transaction) SendContinue() error {
 	if t.write100Continue {
 		t.write100Continue = false
-		io.WriteString(t.conn, "HTTP/1.1 100 Continue\r\n\r\n")
+		if t.respondCalled {
+			return nil
+		}
+		_, err := io.WriteString(t.writer(), "HTTP/1.1 100 Continue\r\n\r\n")
+		t.waitForBody = err == nil && t.server.ContinueTimeout > 0
+		return err
 	}
 	return nil
 }
 
+// SendEarlyHints writes a 103 Early Hints interim response with the given
+// header. Interim responses are not sent to HTTP/1.0 clients or after the
+// final response is started.
+func (t *transaction) SendEarlyHints(header web.Header) error {
+	if t.respondCalled || t.hijacked {
+		return web.ErrInvalidState
+	}
+	if t.req.ProtocolVersion < web.ProtocolVersion(1, 1) {
+		return nil
+	}
+	var b bytes.Buffer
+	b.WriteString("HTTP/1.1 103 Early Hints\r\n")
+	header.WriteHttpHeader(&b)
+	_, err := t.writer().Write(b.Bytes())
+	return err
+}
+
 type identityReader struct{ *transaction }
 
 func (t identityReader) Read(p []byte) (int, error) {
@@ -359,6 +479,27 @@ func readChunkFraming(br *bufio.Reader, first bool) (int, error) {
 	return int(n), nil
 }
 
+// deadlineWriter sets the write deadline on the connection before each write.
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+		return 0, err
+	}
+	return w.conn.Write(p)
+}
+
+// writer returns the writer for the response.
+func (t *transaction) writer() io.Writer {
+	if t.server.WriteTimeout > 0 {
+		return deadlineWriter{t.conn, t.server.WriteTimeout}
+	}
+	return t.conn
+}
+
 func (t *transaction) Respond(status int, header web.Header) (body io.Writer) {
 	if t.hijacked {
 		log.Println("twister: Respond called on hijacked connection")
@@ -382,7 +523,7 @@ func (t *transaction) Respond(status int, header web.Header) (body io.Writer) {
 		t.closeAfterResponse = true
 	}
 
-	if header.Get(web.HeaderConnection) == "close" {
+	if header.Get(web.HeaderConnection) == "close" || t.server.Draining() {
 		t.closeAfterResponse = true
 	}
 
@@ -421,23 +562,29 @@ func (t *transaction) Respond(status int, header web.Header) (body io.Writer) {
 	text := web.StatusText(status)
 
 	var b bytes.Buffer
-	b.WriteString(proto)
-	b.WriteString(" ")
-	b.WriteString(statusString)
-	b.WriteString(" ")
-	b.WriteString(text)
-	b.WriteString("\r\n")
-	header.WriteHttpHeader(&b)
+	// HTTP/0.9 responses do not have a status line or header.
+	if t.req.ProtocolVersion >= web.ProtocolVersion10 {
+		b.WriteString(proto)
+		b.WriteString(" ")
+		b.WriteString(statusString)
+		// The reason phrase is empty for unknown status codes. The space
+		// before the reason phrase is required.
+		b.WriteString(" ")
+		b.WriteString(text)
+		b.WriteString("\r\n")
+		header.WriteHttpHeader(&b)
+	}
 	t.headerSize = b.Len()
 
+	w := &timingWriter{w: t.writer(), timings: t.req.Timings()}
 	const bufferSize = 4096
 	switch {
 	case t.req.Method == "HEAD" || status == web.StatusNotModified:
-		t.responseBody, _ = newNullResponseBody(t.conn, b.Bytes())
+		t.responseBody, _ = newNullResponseBody(w, b.Bytes())
 	case t.chunkedResponse:
-		t.responseBody, _ = newChunkedResponseBody(t.conn, b.Bytes(), bufferSize)
+		t.responseBody, _ = newChunkedResponseBody(w, b.Bytes(), bufferSize)
 	default:
-		t.responseBody, _ = newIdentityResponseBody(t.conn, b.Bytes(), bufferSize, contentLength)
+		t.responseBody, _ = newIdentityResponseBody(w, b.Bytes(), bufferSize, contentLength)
 	}
 	return t.responseBody
 }
@@ -485,6 +632,19 @@ func (t *transaction) invokeHandler() {
 	t.server.Handler.ServeWeb(t.req)
 }
 
+// timingWriter records the time of the first write to the connection.
+type timingWriter struct {
+	w       io.Writer
+	timings *web.Timings
+}
+
+func (w *timingWriter) Write(p []byte) (int, error) {
+	if w.timings.ResponseStart.IsZero() {
+		w.timings.ResponseStart = time.Now()
+	}
+	return w.w.Write(p)
+}
+
 // Finish the HTTP request
 func (t *transaction) finish() error {
 	if !t.respondCalled {
@@ -525,10 +685,28 @@ func (t *transaction) finish() error {
 	return nil
 }
 
+// waitForRequest waits up to timeout for the next request or the request
+// body to arrive. It returns false if the connection should be closed.
+func waitForRequest(conn net.Conn, br *bufio.Reader, timeout time.Duration) bool {
+	if br.Buffered() > 0 {
+		return true
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return false
+	}
+	if _, err := br.Peek(1); err != nil {
+		return false
+	}
+	return conn.SetReadDeadline(time.Time{}) == nil
+}
+
 func (s *Server) serveConnection(conn net.Conn) {
 	defer conn.Close()
 	br := bufio.NewReader(conn)
-	for {
+	for first := true; ; first = false {
+		if !first && s.IdleTimeout > 0 && !waitForRequest(conn, br, s.IdleTimeout) {
+			break
+		}
 		t := &transaction{
 			server: s,
 			conn:   conn,
@@ -17,11 +17,22 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"github.com/garyburd/twister/web"
 	"io"
+	"io/ioutil"
 	"log"
+	"math/big"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -349,3 +360,433 @@ func TestReadRequestLine(t *testing.T) {
 		}
 	}
 }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// stalledConn is a connection to a client that does not read the response.
+type stalledConn struct {
+	testConn
+	deadline time.Time
+}
+
+func (c *stalledConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *stalledConn) Write(b []byte) (int, error) {
+	if c.deadline.IsZero() {
+		select {}
+	}
+	time.Sleep(c.deadline.Sub(time.Now()))
+	return 0, timeoutError{}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	log.SetOutput(silentLogger{t})
+	defer log.SetOutput(os.Stdout)
+
+	l := &testListener{done: make(chan bool, 1)}
+	l.in.WriteString("GET / HTTP/1.1\r\n\r\n")
+	conn := &stalledConn{testConn: testConn{l}}
+
+	copyErr := make(chan error, 1)
+	s := &Server{
+		WriteTimeout: 10 * time.Millisecond,
+		Handler: web.HandlerFunc(func(req *web.Request) {
+			w := req.Respond(web.StatusOK)
+			_, err := io.Copy(w, bytes.NewReader(make([]byte, 1<<20)))
+			copyErr <- err
+		}),
+	}
+	go s.serveConnection(conn)
+
+	select {
+	case err := <-copyErr:
+		if err == nil {
+			t.Error("copy to stalled client did not fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("copy to stalled client did not abort")
+	}
+	<-l.done
+}
+
+func TestDraining(t *testing.T) {
+	log.SetOutput(silentLogger{t})
+	defer log.SetOutput(os.Stdout)
+
+	s := &Server{}
+	router := web.NewRouter().
+		Register("/health", "GET", s.HealthHandler()).
+		Register("/", "GET", testHandler)
+	s.Handler = router
+
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET /health HTTP/1.1\r\nHost: a\r\n\r\nGET /?cl=0 HTTP/1.1\r\nHost: a\r\n\r\n")
+	s.Listener = l
+	s.Serve()
+	<-l.done
+	out := l.out.String()
+	if !strings.HasPrefix(out, "HTTP/1.1 200 OK") {
+		t.Errorf("health not ready: %q", out)
+	}
+	if strings.Contains(out, "Connection: close") {
+		t.Errorf("connection closed before draining: %q", out)
+	}
+
+	s.SetDraining(true)
+	l = &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET /?cl=0 HTTP/1.1\r\nHost: a\r\n\r\nGET /health HTTP/1.1\r\nHost: a\r\n\r\n")
+	s.Listener = l
+	s.Serve()
+	<-l.done
+	out = l.out.String()
+	if !strings.Contains(out, "Connection: close") {
+		t.Errorf("draining response missing Connection: close: %q", out)
+	}
+	if strings.Contains(out, "HTTP/1.1 503") {
+		t.Errorf("connection not closed after first draining response: %q", out)
+	}
+
+	l = &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET /health HTTP/1.1\r\nHost: a\r\n\r\n")
+	s.Listener = l
+	s.Serve()
+	<-l.done
+	if out := l.out.String(); !strings.HasPrefix(out, "HTTP/1.1 503") {
+		t.Errorf("health ready while draining: %q", out)
+	}
+}
+
+// idleConn is a connection to a client that sends one request and then
+// leaves the connection open.
+type idleConn struct {
+	testConn
+	deadline time.Time
+}
+
+func (c *idleConn) SetReadDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if c.in.Len() > 0 {
+		return c.in.Read(b)
+	}
+	if c.deadline.IsZero() {
+		select {}
+	}
+	time.Sleep(c.deadline.Sub(time.Now()))
+	return 0, timeoutError{}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	l := &testListener{done: make(chan bool, 1)}
+	l.in.WriteString("GET /?cl=0 HTTP/1.1\r\nHost: a\r\n\r\n")
+	conn := &idleConn{testConn: testConn{l}}
+	s := &Server{IdleTimeout: 10 * time.Millisecond, Handler: web.HandlerFunc(testHandler)}
+
+	done := make(chan bool)
+	go func() {
+		s.serveConnection(conn)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle connection not closed")
+	}
+	if out := l.out.String(); !strings.HasPrefix(out, "HTTP/1.1 200 OK") || strings.Contains(out, "Connection: close") {
+		t.Errorf("out=%q, want keep-alive response", out)
+	}
+}
+
+func TestTimings(t *testing.T) {
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET / HTTP/1.1\r\nHost: a\r\n\r\n")
+	h := web.HandlerFunc(func(req *web.Request) {
+		timings := req.Timings()
+		if timings.RequestStart.IsZero() {
+			t.Error("request start not set")
+		}
+		if !timings.ResponseStart.IsZero() {
+			t.Error("response start set before respond")
+		}
+		w := req.Respond(web.StatusOK)
+		w.Write([]byte("hello"))
+		w.(web.Flusher).Flush()
+		if timings.ResponseStart.IsZero() {
+			t.Error("response start not set after flush")
+		}
+		if timings.ResponseStart.Before(timings.RequestStart) || timings.TTFB() < 0 {
+			t.Errorf("timings=%+v, TTFB=%v", timings, timings.TTFB())
+		}
+	})
+	(&Server{Listener: l, Handler: h}).Serve()
+	<-l.done
+}
+
+func TestGRPCTrailers(t *testing.T) {
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("POST /svc/Method HTTP/1.1\r\nHost: a\r\nContent-Length: 0\r\nTE: trailers\r\n\r\n")
+	h := web.HandlerFunc(func(req *web.Request) {
+		w := req.Respond(web.StatusOK,
+			web.HeaderContentType, "application/grpc-web+proto",
+			web.HeaderTrailer, web.GRPCTrailer)
+		w.Write([]byte("message"))
+		if err := web.SetGRPCStatus(w, 3, "bad 100%"); err != nil {
+			t.Error(err)
+		}
+	})
+	(&Server{Listener: l, Handler: h}).Serve()
+	<-l.done
+
+	resp, err := http.ReadResponse(bufio.NewReader(&l.out), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "message" {
+		t.Errorf("body=%q, want message", body)
+	}
+	if s := resp.Trailer.Get("Grpc-Status"); s != "3" {
+		t.Errorf("grpc-status=%q, want 3", s)
+	}
+	if s := resp.Trailer.Get("Grpc-Message"); s != "bad 100%25" {
+		t.Errorf("grpc-message=%q, want %q", s, "bad 100%25")
+	}
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestSecure(t *testing.T) {
+	h := web.HandlerFunc(func(req *web.Request) {
+		io.WriteString(req.Respond(web.StatusOK, web.HeaderContentLength, "4"),
+			strconv.FormatBool(req.Secure))
+	})
+
+	// Server.Secure
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET / HTTP/1.0\r\nHost: a\r\n\r\n")
+	(&Server{Listener: l, Handler: h, Secure: true}).Serve()
+	<-l.done
+	if s := l.out.String(); !strings.HasSuffix(s, "\r\n\r\ntrue") {
+		t.Errorf("Server.Secure, response=%q, want body true", s)
+	}
+
+	// TLS connection
+	cert := testCertificate(t)
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+	tl = tls.NewListener(tl, &tls.Config{Certificates: []tls.Certificate{cert}})
+	go (&Server{Listener: tl, Handler: h}).Serve()
+
+	conn, err := tls.Dial("tcp", tl.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.0\r\nHost: a\r\n\r\n")
+	p, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(p); !strings.HasSuffix(s, "\r\n\r\ntrue") {
+		t.Errorf("TLS, response=%q, want body true", s)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET / HTTP/1.1\r\nHost: a\r\n\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n")
+	h := web.MaxResponseSizeHandler(4, web.HandlerFunc(func(req *web.Request) {
+		w := req.Respond(web.StatusOK)
+		io.WriteString(w, "abc")
+		w.(web.Flusher).Flush()
+		if _, err := io.WriteString(w, "def"); err != web.ErrResponseTooLarge {
+			t.Errorf("err=%v, want %v", err, web.ErrResponseTooLarge)
+		}
+	}))
+	(&Server{Listener: l, Handler: h}).Serve()
+	<-l.done
+	if s := l.out.String(); !strings.HasSuffix(s, "\r\n\r\n0003\r\nabc\r\n") || strings.Count(s, "HTTP/1.1 200") != 1 {
+		t.Errorf("response=%q, want one incomplete response", s)
+	}
+}
+
+func TestSetKeepAlive(t *testing.T) {
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET /close HTTP/1.1\r\nHost: a\r\n\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n")
+	h := web.HandlerFunc(func(req *web.Request) {
+		req.SetKeepAlive(false)
+		io.WriteString(req.Respond(web.StatusOK, web.HeaderContentLength, "2"), "ok")
+	})
+	(&Server{Listener: l, Handler: h}).Serve()
+	<-l.done
+	s := l.out.String()
+	if strings.Count(s, "HTTP/1.1 200") != 1 || !strings.Contains(s, "\r\nConnection: close\r\n") {
+		t.Errorf("response=%q, want one response with Connection: close", s)
+	}
+}
+
+func TestSendContinue(t *testing.T) {
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\nHello")
+	var before string
+	h := web.HandlerFunc(func(req *web.Request) {
+		if err := req.SendContinue(); err != nil {
+			t.Error(err)
+		}
+		before = l.out.String()
+		if err := req.SendContinue(); err != nil {
+			t.Error(err)
+		}
+		p, _ := ioutil.ReadAll(req.Body)
+		req.Respond(web.StatusOK, web.HeaderContentLength, strconv.Itoa(len(p))).Write(p)
+	})
+	(&Server{Listener: l, Handler: h}).Serve()
+	<-l.done
+	if before != "HTTP/1.1 100 Continue\r\n\r\n" {
+		t.Errorf("output before reading body=%q, want 100 Continue", before)
+	}
+	want := "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nHello"
+	if s := l.out.String(); s != want {
+		t.Errorf("response=%q, want %q", s, want)
+	}
+}
+
+func TestSendEarlyHints(t *testing.T) {
+	l := &testListener{done: make(chan bool), errs: defaultErrs}
+	l.in.WriteString("GET / HTTP/1.1\r\nHost: a\r\n\r\nGET / HTTP/1.0\r\n\r\n")
+	h := web.HandlerFunc(func(req *web.Request) {
+		req.Preload("/app.css", "style")
+		if err := req.SendEarlyHints(); err != nil {
+			t.Error(err)
+		}
+		req.Respond(web.StatusOK, web.HeaderContentLength, "0")
+	})
+	(&Server{Listener: l, Handler: h}).Serve()
+	<-l.done
+	want := "HTTP/1.1 103 Early Hints\r\nLink: </app.css>; rel=preload; as=style\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 0\r\nLink: </app.css>; rel=preload; as=style\r\n\r\n" +
+		"HTTP/1.0 200 OK\r\nConnection: close\r\nContent-Length: 0\r\nLink: </app.css>; rel=preload; as=style\r\n\r\n"
+	if s := l.out.String(); s != want {
+		t.Errorf("response=%q, want %q", s, want)
+	}
+}
+
+func TestStatusLine(t *testing.T) {
+	for _, tt := range []struct {
+		status int
+		line   string
+	}{
+		{web.StatusNotFound, "HTTP/1.1 404 Not Found\r\n"},
+		{web.StatusTooManyRequests, "HTTP/1.1 429 Too Many Requests\r\n"},
+		{599, "HTTP/1.1 599 \r\n"},
+	} {
+		l := &testListener{done: make(chan bool), errs: defaultErrs}
+		l.in.WriteString("GET / HTTP/1.1\r\nHost: a\r\nConnection: close\r\n\r\n")
+		status := tt.status
+		h := web.HandlerFunc(func(req *web.Request) {
+			req.Respond(status, web.HeaderContentLength, "0")
+		})
+		(&Server{Listener: l, Handler: h}).Serve()
+		<-l.done
+		if s := l.out.String(); !strings.HasPrefix(s, tt.line) {
+			t.Errorf("status %d, response=%q, want prefix %q", tt.status, s, tt.line)
+		}
+	}
+}
+
+func TestHTTP09(t *testing.T) {
+	h := web.HandlerFunc(func(req *web.Request) {
+		if req.ProtocolVersion != web.ProtocolVersion09 {
+			t.Errorf("ProtocolVersion=%d, want %d", req.ProtocolVersion, web.ProtocolVersion09)
+		}
+		io.WriteString(req.Respond(web.StatusOK, web.HeaderContentType, "text/plain"), "path "+req.URL.Path)
+	})
+	for _, tt := range []struct {
+		serve bool
+		out   string
+	}{
+		{true, "path /index.html"},
+		{false, "HTTP/1.1 400 Bad Request\r\n\r\n"},
+	} {
+		l := &testListener{done: make(chan bool), errs: defaultErrs}
+		l.in.WriteString("GET /index.html\r\n")
+		(&Server{Listener: l, Handler: h, ServeHTTP09: tt.serve}).Serve()
+		<-l.done
+		if s := l.out.String(); s != tt.out {
+			t.Errorf("ServeHTTP09=%v, response=%q, want %q", tt.serve, s, tt.out)
+		}
+	}
+}
+
+func TestContinueTimeout(t *testing.T) {
+	readErr := make(chan error, 1)
+	h := web.HandlerFunc(func(req *web.Request) {
+		_, err := ioutil.ReadAll(req.Body)
+		readErr <- err
+		req.Respond(web.StatusBadRequest)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go (&Server{Listener: l, Handler: h, ContinueTimeout: 100 * time.Millisecond}).Serve()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	io.WriteString(conn, "POST / HTTP/1.1\r\nHost: a\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+
+	// The client never sends the body. The server sends 100 Continue, the
+	// read times out and the connection is closed after the response.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read response, %v, want connection closed", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("connection closed after %v, want at least the timeout", elapsed)
+	}
+	if s := string(p); !strings.HasPrefix(s, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 400 ") {
+		t.Errorf("response=%q, want 100 Continue then 400", s)
+	}
+	if err := <-readErr; err != errContinueTimeout {
+		t.Errorf("read err=%v, want %v", err, errContinueTimeout)
+	}
+}
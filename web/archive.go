@@ -0,0 +1,52 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+)
+
+// respondAttachment responds to the request with an attachment of the given
+// content type and file name. The response body is streamed to the client.
+func (req *Request) respondAttachment(status int, contentType, filename string) io.Writer {
+	return req.Respond(status,
+		HeaderContentType, contentType,
+		HeaderContentDisposition, "attachment; filename="+QuoteHeaderValue(filename))
+}
+
+// ZipStream responds to the request with a zip archive and returns a writer
+// for the archive entries. The archive is streamed to the client as entries
+// are written. The application must close the returned writer to complete
+// the archive.
+//
+//  zw, err := req.ZipStream(web.StatusOK, "files.zip")
+//  if err != nil {
+//      return
+//  }
+//  f, err := zw.Create("hello.txt")
+//  ...
+//  zw.Close()
+func (req *Request) ZipStream(status int, filename string) (*zip.Writer, error) {
+	return zip.NewWriter(req.respondAttachment(status, "application/zip", filename)), nil
+}
+
+// TarStream responds to the request with a tar archive and returns a writer
+// for the archive entries. The application must close the returned writer to
+// complete the archive.
+func (req *Request) TarStream(status int, filename string) (*tar.Writer, error) {
+	return tar.NewWriter(req.respondAttachment(status, "application/x-tar", filename)), nil
+}
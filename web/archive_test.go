@@ -0,0 +1,108 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+var archiveTestFiles = []struct {
+	name, body string
+}{
+	{"a.txt", "hello"},
+	{"dir/b.txt", "world"},
+}
+
+func TestZipStream(t *testing.T) {
+	h := HandlerFunc(func(req *Request) {
+		zw, err := req.ZipStream(StatusOK, "files.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range archiveTestFiles {
+			w, err := zw.Create(f.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, f.body)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	status, header, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if status != StatusOK {
+		t.Errorf("status=%d, want %d", status, StatusOK)
+	}
+	if ct := header.Get(HeaderContentType); ct != "application/zip" {
+		t.Errorf("content type=%q", ct)
+	}
+	if cd := header.Get(HeaderContentDisposition); cd != `attachment; filename="files.zip"` {
+		t.Errorf("content disposition=%q", cd)
+	}
+	if header.Get(HeaderContentLength) != "" {
+		t.Errorf("content length set for streamed archive")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != len(archiveTestFiles) {
+		t.Fatalf("entries=%d, want %d", len(zr.File), len(archiveTestFiles))
+	}
+	for i, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if f.Name != archiveTestFiles[i].name || string(p) != archiveTestFiles[i].body {
+			t.Errorf("entry %d = %s %q, want %s %q", i, f.Name, p, archiveTestFiles[i].name, archiveTestFiles[i].body)
+		}
+	}
+}
+
+func TestTarStream(t *testing.T) {
+	h := HandlerFunc(func(req *Request) {
+		tw, _ := req.TarStream(StatusOK, "files.tar")
+		for _, f := range archiveTestFiles {
+			tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body))})
+			io.WriteString(tw, f.body)
+		}
+		tw.Close()
+	})
+	_, header, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if ct := header.Get(HeaderContentType); ct != "application/x-tar" {
+		t.Errorf("content type=%q", ct)
+	}
+	tr := tar.NewReader(bytes.NewReader(body))
+	for i, f := range archiveTestFiles {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("entry %d, %v", i, err)
+		}
+		p, _ := ioutil.ReadAll(tr)
+		if hdr.Name != f.name || string(p) != f.body {
+			t.Errorf("entry %d = %s %q, want %s %q", i, hdr.Name, p, f.name, f.body)
+		}
+	}
+}
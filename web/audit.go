@@ -0,0 +1,241 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AuditRecord is a captured request-response pair.
+type AuditRecord struct {
+	Time           time.Time
+	RemoteAddr     string
+	Method         string
+	URL            string
+	RequestHeader  Header
+	RequestBody    []byte
+	Status         int
+	ResponseHeader Header
+	ResponseBody   []byte
+
+	// True if the corresponding body was longer than the capture limit.
+	RequestTruncated  bool
+	ResponseTruncated bool
+}
+
+// AuditHandler returns a handler that captures requests and responses to
+// sink. Up to maxBody bytes of the request and response bodies are captured.
+// The request body is captured as it is read by h.
+//
+// Header values, query and form parameters and JSON object members with a
+// name in redact are replaced with "REDACTED" in the captured record. Names
+// are compared case insensitively. A captured body that cannot be parsed for
+// redaction is discarded.
+//
+// The sink is called after h returns.
+func AuditHandler(sink func(*AuditRecord), maxBody int, redact []string, h Handler) Handler {
+	r := make(map[string]bool)
+	for _, name := range redact {
+		r[strings.ToLower(name)] = true
+	}
+	return &auditHandler{sink: sink, maxBody: maxBody, redact: r, h: h}
+}
+
+type auditHandler struct {
+	sink    func(*AuditRecord)
+	maxBody int
+	redact  map[string]bool
+	h       Handler
+}
+
+const redacted = "REDACTED"
+
+// captureBuffer holds up to max bytes written to it.
+type captureBuffer struct {
+	p         []byte
+	max       int
+	truncated bool
+}
+
+func (b *captureBuffer) capture(p []byte) {
+	if n := b.max - len(b.p); n < len(p) {
+		p = p[:n]
+		b.truncated = true
+	}
+	b.p = append(b.p, p...)
+}
+
+type auditReader struct {
+	r   io.Reader
+	buf *captureBuffer
+}
+
+func (r auditReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf.capture(p[:n])
+	return n, err
+}
+
+type auditResponder struct {
+	Responder
+	rec *AuditRecord
+	buf *captureBuffer
+}
+
+func (r *auditResponder) Respond(status int, header Header) io.Writer {
+	r.rec.Status = status
+	r.rec.ResponseHeader = copyHeader(header)
+	return &auditWriter{r.Responder.Respond(status, header), r.buf}
+}
+
+type auditWriter struct {
+	w   io.Writer
+	buf *captureBuffer
+}
+
+func (w *auditWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.buf.capture(p[:n])
+	return n, err
+}
+
+func (w *auditWriter) Flush() error {
+	if f, ok := w.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func copyHeader(header Header) Header {
+	result := make(Header)
+	for k, v := range header {
+		result[k] = append([]string(nil), v...)
+	}
+	return result
+}
+
+func (h *auditHandler) ServeWeb(req *Request) {
+	rec := &AuditRecord{
+		Time:          nowFunc(),
+		RemoteAddr:    req.RemoteAddr,
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: copyHeader(req.Header),
+	}
+	reqBuf := &captureBuffer{max: h.maxBody}
+	if req.Body != nil {
+		req.Body = auditReader{req.Body, reqBuf}
+	}
+	respBuf := &captureBuffer{max: h.maxBody}
+	req.Responder = &auditResponder{req.Responder, rec, respBuf}
+
+	h.h.ServeWeb(req)
+
+	rec.RequestBody, rec.RequestTruncated = reqBuf.p, reqBuf.truncated
+	rec.ResponseBody, rec.ResponseTruncated = respBuf.p, respBuf.truncated
+	if len(h.redact) > 0 {
+		h.redactRecord(rec, req.ContentType)
+	}
+	h.sink(rec)
+}
+
+func (h *auditHandler) redactRecord(rec *AuditRecord, requestContentType string) {
+	h.redactHeader(rec.RequestHeader)
+	h.redactHeader(rec.ResponseHeader)
+	if u, err := url.Parse(rec.URL); err == nil && u.RawQuery != "" {
+		m := make(Values)
+		if m.ParseFormEncodedBytes([]byte(u.RawQuery)) == nil {
+			h.redactValues(m)
+			u.RawQuery = m.FormEncodedString()
+			rec.URL = u.String()
+		}
+	}
+	rec.RequestBody = h.redactBody(rec.RequestBody, requestContentType)
+	if rec.ResponseHeader != nil {
+		ct, _ := rec.ResponseHeader.GetValueParam(HeaderContentType)
+		rec.ResponseBody = h.redactBody(rec.ResponseBody, ct)
+	}
+}
+
+func (h *auditHandler) redactHeader(header Header) {
+	for k, values := range header {
+		if h.redact[strings.ToLower(k)] {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+}
+
+func (h *auditHandler) redactValues(m Values) {
+	for k, values := range m {
+		if h.redact[strings.ToLower(k)] {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+}
+
+func (h *auditHandler) redactJSON(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if h.redact[strings.ToLower(k)] {
+				v[k] = redacted
+			} else {
+				h.redactJSON(e)
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			h.redactJSON(e)
+		}
+	}
+}
+
+// redactBody returns body with the redacted fields replaced for form encoded
+// and JSON bodies. Other bodies cannot be parsed for redaction and are
+// discarded.
+func (h *auditHandler) redactBody(body []byte, contentType string) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	switch {
+	case contentType == "application/x-www-form-urlencoded":
+		m := make(Values)
+		if err := m.ParseFormEncodedBytes(append([]byte(nil), body...)); err != nil {
+			return nil
+		}
+		h.redactValues(m)
+		return m.FormEncodedBytes()
+	case isJSONContentType(contentType):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil
+		}
+		h.redactJSON(v)
+		p, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return p
+	}
+	return nil
+}
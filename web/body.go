@@ -0,0 +1,134 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrUnsupportedMediaType is returned by ParseBody when the request content
+// type is not supported. Handlers should respond to the request with status
+// 415 when they encounter this error.
+var ErrUnsupportedMediaType = errors.New("twister: unsupported request content type")
+
+// ErrMissingFile is returned by FormFile when the request does not have a
+// file for the field.
+var ErrMissingFile = errors.New("twister: no such file in request")
+
+// MaxFormFileBodyLen is the maximum length of a request body parsed by
+// ParseBody and FormFile.
+const MaxFormFileBodyLen = 32 << 20
+
+const (
+	bodyParsedEnvKey = "twister.web.bodyParsed"
+	filesEnvKey      = "twister.web.Files"
+)
+
+// ParseBody parses the request body using the request content type and adds
+// the parsed values to the request Param. The supported content types are:
+//
+//  application/x-www-form-urlencoded
+//  multipart/form-data
+//  application/json and application/*+json
+//
+// Files in multipart/form-data bodies are added to the request Env with the
+// key "twister.web.Files" as a []Part. Use FormFile to get a file by field
+// name.
+//
+// The members of a JSON object body are added to the request Param. Arrays of
+// values are added as multiple values. Nested objects and arrays are added in
+// JSON encoding.
+//
+// ParseBody returns ErrUnsupportedMediaType for other content types and
+// ErrRequestEntityTooLarge if the body is longer than MaxFormFileBodyLen.
+// Requests without a body are not parsed. ParseBody is idempotent and does
+// not parse a body already parsed by ParseForm.
+func (req *Request) ParseBody() error {
+	return req.parseBody(MaxFormFileBodyLen)
+}
+
+func (req *Request) parseBody(maxRequestBodyLen int) error {
+	if req.Env[bodyParsedEnvKey] != nil || req.ContentLength == 0 {
+		return nil
+	}
+	req.Env[bodyParsedEnvKey] = true
+	switch {
+	case req.ContentType == "application/x-www-form-urlencoded":
+		p, err := req.BodyBytes(maxRequestBodyLen)
+		if err != nil {
+			return err
+		}
+		return req.Param.ParseFormEncodedBytes(p)
+	case req.ContentType == "multipart/form-data":
+		parts, err := ParseMultipartForm(req, maxRequestBodyLen)
+		if err != nil {
+			return err
+		}
+		req.Env[filesEnvKey] = parts
+		return nil
+	case isJSONContentType(req.ContentType):
+		var m map[string]interface{}
+		if err := req.decodeJSON(&m, maxRequestBodyLen); err != nil {
+			return err
+		}
+		for k, v := range m {
+			if a, ok := v.([]interface{}); ok {
+				for _, v := range a {
+					req.Param.Add(k, jsonParamValue(v))
+				}
+			} else {
+				req.Param.Add(k, jsonParamValue(v))
+			}
+		}
+		return nil
+	}
+	return ErrUnsupportedMediaType
+}
+
+// jsonParamValue returns the request parameter value for a decoded JSON
+// value.
+func jsonParamValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	p, _ := json.Marshal(v)
+	return string(p)
+}
+
+// FormFile returns the first file uploaded for the named field of a
+// multipart/form-data request. If the request body has not been parsed, then
+// FormFile parses the body with ParseBody.
+// FormFile returns ErrMissingFile if there is no file for the field.
+func (req *Request) FormFile(name string) (*Part, error) {
+	if err := req.ParseBody(); err != nil {
+		return nil, err
+	}
+	parts, _ := req.Env[filesEnvKey].([]Part)
+	for i := range parts {
+		if parts[i].Name == name {
+			return &parts[i], nil
+		}
+	}
+	return nil, ErrMissingFile
+}
@@ -0,0 +1,118 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestRequest returns a request with the given content type and body.
+func newTestRequest(method, contentType, body string) *Request {
+	header := NewHeader(HeaderContentLength, strconv.Itoa(len(body)))
+	if contentType != "" {
+		header.Set(HeaderContentType, contentType)
+	}
+	req, err := NewRequest("1.2.3.4", method, "/", ProtocolVersion11, &url.URL{Path: "/"}, header)
+	if err != nil {
+		panic(err)
+	}
+	req.Body = strings.NewReader(body)
+	return req
+}
+
+var parseBodyTests = []struct {
+	contentType string
+	body        string
+	param       Values
+	err         error
+}{
+	{"application/x-www-form-urlencoded", "a=1&b=2&a=3", NewValues("a", "1", "a", "3", "b", "2"), nil},
+	{"application/json", `{"a":"x","n":1.5,"t":true,"l":[1,"y"],"o":{"k":null}}`,
+		NewValues("a", "x", "n", "1.5", "t", "true", "l", "1", "l", "y", "o", `{"k":null}`), nil},
+	{"application/vnd.api+json; charset=utf-8", `{"a":"x"}`, NewValues("a", "x"), nil},
+	{"multipart/form-data; boundary=deadbeef",
+		"--deadbeef\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\n1\r\n--deadbeef--\r\n",
+		NewValues("a", "1"), nil},
+	{"text/plain", "hello", NewValues(), ErrUnsupportedMediaType},
+	{"", "hello", NewValues(), ErrUnsupportedMediaType},
+}
+
+func TestParseBody(t *testing.T) {
+	for _, tt := range parseBodyTests {
+		req := newTestRequest("POST", tt.contentType, tt.body)
+		err := req.ParseBody()
+		if err != tt.err {
+			t.Errorf("%s, err=%v, want %v", tt.contentType, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(req.Param, tt.param) {
+			t.Errorf("%s, param=%v, want %v", tt.contentType, req.Param, tt.param)
+		}
+	}
+
+	req := newTestRequest("POST", "application/json", `[1, 2]`)
+	if err := req.ParseBody(); err == nil {
+		t.Errorf("JSON array body, no error")
+	}
+
+	req = newTestRequest("POST", "application/x-www-form-urlencoded", "a=1")
+	if err := req.parseBody(2); err != ErrRequestEntityTooLarge {
+		t.Errorf("large body, err=%v, want %v", err, ErrRequestEntityTooLarge)
+	}
+
+	req = newTestRequest("GET", "", "")
+	if err := req.ParseBody(); err != nil {
+		t.Errorf("no body, err=%v", err)
+	}
+
+	// The body is not parsed again after ParseForm.
+	req = newTestRequest("POST", "application/x-www-form-urlencoded", "a=1")
+	if err := req.ParseForm(1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.ParseBody(); err != nil || !reflect.DeepEqual(req.Param, NewValues("a", "1")) {
+		t.Errorf("ParseBody after ParseForm, err=%v, param=%v", err, req.Param)
+	}
+}
+
+const testUploadBody = "--deadbeef\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n\r\n" +
+	"Hello\r\n" +
+	"--deadbeef\r\n" +
+	"Content-Disposition: form-data; name=\"upload\"; filename=\"hello.txt\"\r\n" +
+	"Content-Type: text/plain\r\n\r\n" +
+	"Hello, World!\r\n" +
+	"--deadbeef--\r\n"
+
+func TestFormFile(t *testing.T) {
+	req := newTestRequest("POST", "multipart/form-data; boundary=deadbeef", testUploadBody)
+	part, err := req.FormFile("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if part.Filename != "hello.txt" || part.ContentType != "text/plain" || string(part.Data) != "Hello, World!" {
+		t.Errorf("part=%+v", part)
+	}
+	if title := req.Param.Get("title"); title != "Hello" {
+		t.Errorf("title=%q, want Hello", title)
+	}
+	if _, err := req.FormFile("title"); err != ErrMissingFile {
+		t.Errorf("FormFile(title) err=%v, want %v", err, ErrMissingFile)
+	}
+}
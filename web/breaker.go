@@ -0,0 +1,302 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errCircuitOpen = errors.New("twister: circuit open")
+
+// CircuitBreakerOptions configures a CircuitBreakerHandler.
+type CircuitBreakerOptions struct {
+	// Number of recent requests used to compute the failure rate. The default
+	// is 20.
+	Window int
+
+	// The circuit opens when the failure rate over a full window reaches this
+	// value. The default is 0.5.
+	MaxFailureRate float64
+
+	// Requests that take longer than MaxLatency are counted as failures. If
+	// zero, then latency is not checked.
+	MaxLatency time.Duration
+
+	// Duration that the circuit stays open. The default is 30 seconds.
+	Cooldown time.Duration
+}
+
+// CircuitBreakerHandler is a request handler that sheds load from a failing
+// handler. The circuit breaker tracks the outcome of recent requests. A
+// request fails if the response status is 500 or greater or if the request
+// takes longer than the configured maximum latency. When the failure rate
+// reaches the configured threshold, the circuit opens and the handler
+// responds to all requests with status 503 for the cooldown period.
+type CircuitBreakerHandler struct {
+	options CircuitBreakerOptions
+	h       Handler
+
+	mu        sync.Mutex
+	results   []bool // ring of recent results, true for failure
+	next      int    // next position in results
+	count     int    // number of results in ring
+	failures  int    // number of failures in ring
+	openUntil time.Time
+}
+
+// NewCircuitBreakerHandler returns a circuit breaker for handler h.
+func NewCircuitBreakerHandler(options CircuitBreakerOptions, h Handler) *CircuitBreakerHandler {
+	if options.Window <= 0 {
+		options.Window = 20
+	}
+	if options.MaxFailureRate <= 0 {
+		options.MaxFailureRate = 0.5
+	}
+	if options.Cooldown <= 0 {
+		options.Cooldown = 30 * time.Second
+	}
+	return &CircuitBreakerHandler{
+		options: options,
+		h:       h,
+		results: make([]bool, options.Window),
+	}
+}
+
+// Open returns true if the circuit is open.
+func (cb *CircuitBreakerHandler) Open() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return nowFunc().Before(cb.openUntil)
+}
+
+// FailureRate returns the failure rate over the recorded requests in the
+// current window.
+func (cb *CircuitBreakerHandler) FailureRate() float64 {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.count == 0 {
+		return 0
+	}
+	return float64(cb.failures) / float64(cb.count)
+}
+
+func (cb *CircuitBreakerHandler) record(failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.count == len(cb.results) {
+		if cb.results[cb.next] {
+			cb.failures -= 1
+		}
+	} else {
+		cb.count += 1
+	}
+	cb.results[cb.next] = failed
+	cb.next = (cb.next + 1) % len(cb.results)
+	if failed {
+		cb.failures += 1
+	}
+	if cb.count == len(cb.results) &&
+		float64(cb.failures)/float64(cb.count) >= cb.options.MaxFailureRate {
+		cb.openUntil = nowFunc().Add(cb.options.Cooldown)
+		cb.count = 0
+		cb.failures = 0
+		cb.next = 0
+	}
+}
+
+func (cb *CircuitBreakerHandler) ServeWeb(req *Request) {
+	cb.mu.Lock()
+	remaining := cb.openUntil.Sub(nowFunc())
+	cb.mu.Unlock()
+	if remaining > 0 {
+		retryAfter := int((remaining + time.Second - 1) / time.Second)
+		req.Error(StatusServiceUnavailable, errCircuitOpen, HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return
+	}
+
+	status := 0
+	FilterRespond(req, func(s int, header Header) (int, Header) {
+		status = s
+		return s, header
+	})
+	start := nowFunc()
+	failed := true
+	defer func() {
+		if status >= 500 ||
+			(cb.options.MaxLatency > 0 && nowFunc().Sub(start) > cb.options.MaxLatency) {
+			failed = true
+		}
+		cb.record(failed)
+	}()
+	cb.h.ServeWeb(req)
+	failed = false
+}
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	// Requests are allowed.
+	BreakerClosed BreakerState = iota
+
+	// Requests are rejected until the cooldown period elapses.
+	BreakerOpen
+
+	// A single probe request is allowed. The result of the probe determines
+	// if the breaker closes or opens again.
+	BreakerHalfOpen
+)
+
+var breakerStateText = map[BreakerState]string{
+	BreakerClosed:   "closed",
+	BreakerOpen:     "open",
+	BreakerHalfOpen: "half-open",
+}
+
+func (s BreakerState) String() string {
+	return breakerStateText[s]
+}
+
+// Breaker is a circuit breaker for calls to a downstream service. Handlers
+// call Allow before calling the service and report the result of the call
+// with Success or Failure.
+//
+// The breaker opens after maxFailures consecutive failures. After the cooldown
+// period, the breaker moves to the half-open state and allows a single probe.
+// The breaker closes if the probe succeeds and opens again if the probe fails.
+type Breaker struct {
+	maxFailures int
+	cooldown    time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a new breaker in the closed state.
+func NewBreaker(maxFailures int, cooldown time.Duration) *Breaker {
+	if maxFailures <= 0 {
+		maxFailures = 1
+	}
+	return &Breaker{maxFailures: maxFailures, cooldown: cooldown}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && !nowFunc().Before(b.openedAt.Add(b.cooldown)) {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow returns true if the caller should proceed with the call.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if nowFunc().Before(b.openedAt.Add(b.cooldown)) {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success reports a successful call. In the half-open state, the success of
+// the probe closes the breaker. Successes reported while the breaker is open
+// are from calls that started before the breaker opened and are ignored.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		b.failures = 0
+	case BreakerHalfOpen:
+		if b.probing {
+			b.state = BreakerClosed
+			b.failures = 0
+			b.probing = false
+		}
+	}
+}
+
+// Failure reports a failed call. Failures reported while the breaker is open
+// are ignored so that calls that started before the breaker opened do not
+// extend the cooldown period.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		return
+	}
+	b.failures += 1
+	if b.state == BreakerHalfOpen || b.failures >= b.maxFailures {
+		b.state = BreakerOpen
+		b.openedAt = nowFunc()
+		b.failures = 0
+		b.probing = false
+	}
+}
+
+// BreakerHandler returns a handler that guards h with breaker b. If the
+// breaker does not allow the request, then the handler responds with status
+// 503. Responses with status 500 or greater are reported to the breaker as
+// failures. All other responses are reported as successes.
+func BreakerHandler(b *Breaker, h Handler) Handler {
+	return breakerHandler{b, h}
+}
+
+type breakerHandler struct {
+	b *Breaker
+	h Handler
+}
+
+func (h breakerHandler) ServeWeb(req *Request) {
+	if !h.b.Allow() {
+		req.Error(StatusServiceUnavailable, errCircuitOpen)
+		return
+	}
+	status := 0
+	FilterRespond(req, func(s int, header Header) (int, Header) {
+		status = s
+		return s, header
+	})
+	failed := true
+	defer func() {
+		if failed || status >= 500 {
+			h.b.Failure()
+		} else {
+			h.b.Success()
+		}
+	}()
+	h.h.ServeWeb(req)
+	failed = false
+}
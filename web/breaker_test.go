@@ -0,0 +1,155 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerHandler(t *testing.T) {
+	fail := true
+	calls := 0
+	h := NewCircuitBreakerHandler(CircuitBreakerOptions{
+		Window:         4,
+		MaxFailureRate: 0.5,
+		Cooldown:       50 * time.Millisecond,
+	}, HandlerFunc(func(req *Request) {
+		calls += 1
+		if fail {
+			req.Error(StatusInternalServerError, nil)
+		} else {
+			req.Respond(StatusOK)
+		}
+	}))
+
+	for i := 0; i < 4; i++ {
+		if h.Open() {
+			t.Fatalf("circuit open after %d requests", i)
+		}
+		status, _, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+		if status != StatusInternalServerError {
+			t.Errorf("request %d, status=%d, want %d", i, status, StatusInternalServerError)
+		}
+	}
+
+	if !h.Open() {
+		t.Fatal("circuit not open after failures")
+	}
+
+	status, header, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if status != StatusServiceUnavailable {
+		t.Errorf("open circuit, status=%d, want %d", status, StatusServiceUnavailable)
+	}
+	if header.Get(HeaderRetryAfter) == "" {
+		t.Errorf("open circuit, Retry-After not set")
+	}
+	if calls != 4 {
+		t.Errorf("calls=%d, want 4", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	fail = false
+
+	if h.Open() {
+		t.Fatal("circuit open after cooldown")
+	}
+	status, _, _ = RunHandler("http://example.com/", "GET", nil, nil, h)
+	if status != StatusOK {
+		t.Errorf("after cooldown, status=%d, want %d", status, StatusOK)
+	}
+	if rate := h.FailureRate(); rate != 0 {
+		t.Errorf("after cooldown, failure rate=%v, want 0", rate)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(2, 50*time.Millisecond)
+	fail := true
+	h := BreakerHandler(b, HandlerFunc(func(req *Request) {
+		if fail {
+			req.Error(StatusBadGateway, nil)
+		} else {
+			req.Respond(StatusOK)
+		}
+	}))
+
+	expect := func(what string, state BreakerState, status int) {
+		s, _, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+		if s != status {
+			t.Errorf("%s, status=%d, want %d", what, s, status)
+		}
+		if st := b.State(); st != state {
+			t.Errorf("%s, state=%v, want %v", what, st, state)
+		}
+	}
+
+	expect("first failure", BreakerClosed, StatusBadGateway)
+	expect("second failure", BreakerOpen, StatusBadGateway)
+	expect("open", BreakerOpen, StatusServiceUnavailable)
+
+	time.Sleep(60 * time.Millisecond)
+	if st := b.State(); st != BreakerHalfOpen {
+		t.Errorf("after cooldown, state=%v, want %v", st, BreakerHalfOpen)
+	}
+	expect("failed probe", BreakerOpen, StatusBadGateway)
+
+	time.Sleep(60 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("probe not allowed after cooldown")
+	}
+	if b.Allow() {
+		t.Error("second probe allowed while half-open")
+	}
+	b.Success()
+	if st := b.State(); st != BreakerClosed {
+		t.Errorf("after probe, state=%v, want %v", st, BreakerClosed)
+	}
+
+	fail = false
+	expect("closed", BreakerClosed, StatusOK)
+}
+
+func TestBreakerStaleResults(t *testing.T) {
+	now := time.Unix(1300000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	b := NewBreaker(1, time.Minute)
+	b.Failure()
+	if st := b.State(); st != BreakerOpen {
+		t.Fatalf("state=%v, want %v", st, BreakerOpen)
+	}
+
+	// Results from calls that started before the breaker opened.
+	b.Success()
+	if st := b.State(); st != BreakerOpen {
+		t.Errorf("after stale success, state=%v, want %v", st, BreakerOpen)
+	}
+	now = now.Add(30 * time.Second)
+	b.Failure()
+	now = now.Add(31 * time.Second)
+	if st := b.State(); st != BreakerHalfOpen {
+		t.Errorf("after stale failure and cooldown, state=%v, want %v", st, BreakerHalfOpen)
+	}
+
+	if !b.Allow() {
+		t.Fatal("probe not allowed")
+	}
+	b.Success()
+	if st := b.State(); st != BreakerClosed {
+		t.Errorf("after probe success, state=%v, want %v", st, BreakerClosed)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// CharsetHandler returns a handler that negotiates the charset of text
+// responses using the request's Accept-Charset header. The handler h writes
+// text responses encoded as UTF-8. If the client prefers ISO-8859-1, then
+// the response body is transcoded to ISO-8859-1 and characters that cannot
+// be represented in ISO-8859-1 are replaced with '?'. The negotiated charset
+// is set as the charset parameter of the Content-Type header.
+//
+// Responses with a media type other than text/* and responses with a charset
+// other than UTF-8 are not modified. If the request does not have an
+// Accept-Charset header or none of the charsets are acceptable to the client,
+// then the response is sent as UTF-8.
+func CharsetHandler(h Handler) Handler {
+	return charsetHandler{h}
+}
+
+type charsetHandler struct {
+	h Handler
+}
+
+func (h charsetHandler) ServeWeb(req *Request) {
+	req.Responder = &charsetResponder{req.Responder, req}
+	h.h.ServeWeb(req)
+}
+
+type charsetResponder struct {
+	Responder
+	req *Request
+}
+
+func (r *charsetResponder) Respond(status int, header Header) io.Writer {
+	mediaType, param := header.GetValueParam(HeaderContentType)
+	if !strings.HasPrefix(mediaType, "text/") {
+		return r.Responder.Respond(status, header)
+	}
+	if cs := strings.ToLower(param["charset"]); cs != "" && cs != "utf-8" {
+		return r.Responder.Respond(status, header)
+	}
+	cs := r.req.AcceptsCharset("utf-8", "iso-8859-1")
+	if cs == "" {
+		cs = "utf-8"
+	}
+	header.Set(HeaderContentType, mediaType+"; charset=\""+cs+"\"")
+	if cs == "utf-8" {
+		return r.Responder.Respond(status, header)
+	}
+	header.Delete(HeaderContentLength)
+	return &latin1Writer{w: r.Responder.Respond(status, header)}
+}
+
+// latin1Writer transcodes UTF-8 to ISO-8859-1.
+type latin1Writer struct {
+	w io.Writer
+
+	// Incomplete UTF-8 sequence from the end of the previous write.
+	partial []byte
+}
+
+func (w *latin1Writer) Write(p []byte) (int, error) {
+	s := p
+	if len(w.partial) > 0 {
+		s = append(w.partial, p...)
+		w.partial = nil
+	}
+	b := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		if !utf8.FullRune(s) {
+			w.partial = append([]byte(nil), s...)
+			break
+		}
+		r, size := utf8.DecodeRune(s)
+		if r > 0xff {
+			r = '?'
+		}
+		b = append(b, byte(r))
+		s = s[size:]
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *latin1Writer) Flush() error {
+	if f, ok := w.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"testing"
+)
+
+var charsetTests = []struct {
+	acceptCharset string
+	contentType   string
+	wantType      string
+	wantBody      string
+}{
+	{"", "text/plain", `text/plain; charset="utf-8"`, "café €"},
+	{"utf-8", "text/plain", `text/plain; charset="utf-8"`, "café €"},
+	{"iso-8859-1, utf-8;q=0.5", "text/plain", `text/plain; charset="iso-8859-1"`, "caf\xe9 ?"},
+	{"ISO-8859-1", `text/html; charset="utf-8"`, `text/html; charset="iso-8859-1"`, "caf\xe9 ?"},
+	{"iso-8859-1, *;q=0.1", "text/plain", `text/plain; charset="iso-8859-1"`, "caf\xe9 ?"},
+	{"utf-16", "text/plain", `text/plain; charset="utf-8"`, "café €"},
+	{"iso-8859-1", "application/json", "application/json", "café €"},
+	{"iso-8859-1", "text/plain; charset=koi8-r", "text/plain; charset=koi8-r", "café €"},
+}
+
+func TestCharsetHandler(t *testing.T) {
+	h := CharsetHandler(HandlerFunc(func(req *Request) {
+		w := req.Respond(StatusOK, HeaderContentType, req.Param.Get("type"))
+		// Split the multi-byte characters across writes.
+		io.WriteString(w, "caf\xc3")
+		io.WriteString(w, "\xa9 \xe2\x82")
+		io.WriteString(w, "\xac")
+	}))
+	for _, tt := range charsetTests {
+		header := NewHeader()
+		if tt.acceptCharset != "" {
+			header.Set(HeaderAcceptCharset, tt.acceptCharset)
+		}
+		req, resp := NewTestRequest("GET", "http://example.com/", header, nil)
+		req.Param.Set("type", tt.contentType)
+		h.ServeWeb(req)
+		if ct := resp.Header().Get(HeaderContentType); ct != tt.wantType {
+			t.Errorf("%q %q, Content-Type=%q, want %q", tt.acceptCharset, tt.contentType, ct, tt.wantType)
+		}
+		if body := string(resp.Body()); body != tt.wantBody {
+			t.Errorf("%q %q, body=%q, want %q", tt.acceptCharset, tt.contentType, body, tt.wantBody)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"strings"
+	"sync"
+)
+
+// revalidateCall is an in-flight or completed call to a revalidate function.
+type revalidateCall struct {
+	wg   sync.WaitGroup
+	etag string
+	err  error
+	dups int
+}
+
+// revalidateGroup ensures that only one call to the revalidate function is in
+// flight for a given key.
+type revalidateGroup struct {
+	mu    sync.Mutex
+	calls map[string]*revalidateCall
+}
+
+func (g *revalidateGroup) do(key string, fn func() (string, error)) (string, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		c.dups += 1
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.etag, c.err
+	}
+	c := &revalidateCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.etag, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.etag, c.err
+}
+
+type coalesceHandler struct {
+	key        func(*Request) string
+	revalidate func(*Request) (string, error)
+	h          Handler
+	group      revalidateGroup
+}
+
+// CoalesceHandler returns a handler that coalesces the revalidation of
+// concurrent conditional GET requests.
+//
+// For GET and HEAD requests with an If-None-Match header, the handler calls
+// revalidate to get the current entity tag of the resource identified by
+// key(req). Concurrent requests with the same key share a single call to
+// revalidate. If the entity tag matches the If-None-Match header, then the
+// handler responds with status 304. Otherwise, the request is dispatched to h.
+//
+// The revalidate function returns the entity tag without quotes. If revalidate
+// returns an error, then the handler responds with status 500.
+func CoalesceHandler(key func(*Request) string, revalidate func(*Request) (string, error), h Handler) Handler {
+	ch := &coalesceHandler{key: key, revalidate: revalidate, h: h}
+	ch.group.calls = make(map[string]*revalidateCall)
+	return ch
+}
+
+func (ch *coalesceHandler) ServeWeb(req *Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		ch.h.ServeWeb(req)
+		return
+	}
+	inm := req.Header.GetList(HeaderIfNoneMatch)
+	if len(inm) == 0 {
+		ch.h.ServeWeb(req)
+		return
+	}
+	etag, err := ch.group.do(ch.key(req), func() (string, error) { return ch.revalidate(req) })
+	if err != nil {
+		req.Error(StatusInternalServerError, err)
+		return
+	}
+	for _, qetag := range inm {
+		if qetag == "*" || UnquoteHeaderValue(qetag) == etag {
+			req.Respond(StatusNotModified, HeaderETag, QuoteHeaderValue(etag))
+			return
+		}
+	}
+	ch.h.ServeWeb(req)
+}
+
+// CheckIfMatch checks the request's If-Match header against etag, the current
+// entity tag of the resource without quotes. Pass "" for etag if the resource
+// does not exist. If the precondition fails, then CheckIfMatch responds with
+// status 412 and returns true. The precondition passes when the request does
+// not have an If-Match header, when the header is "*" and the resource
+// exists, or when one of the entity tags in the header is equal to etag. Weak
+// entity tags never match as required by RFC 7232.
+//
+//  if req.CheckIfMatch(item.ETag) {
+//      return
+//  }
+//  // update item
+func (req *Request) CheckIfMatch(etag string) (done bool) {
+	im := req.Header.GetList(HeaderIfMatch)
+	if len(im) == 0 {
+		return false
+	}
+	for _, qetag := range im {
+		if qetag == "*" {
+			if etag != "" {
+				return false
+			}
+		} else if etag != "" && !strings.HasPrefix(qetag, "W/") && UnquoteHeaderValue(qetag) == etag {
+			return false
+		}
+	}
+	req.Error(StatusPreconditionFailed, nil)
+	return true
+}
@@ -0,0 +1,118 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceHandler(t *testing.T) {
+	const n = 10
+
+	var calls int32
+	release := make(chan bool)
+	revalidate := func(req *Request) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v1", nil
+	}
+	key := func(req *Request) string { return req.URL.Path }
+	h := CoalesceHandler(key, revalidate, routeTestHandler("full")).(*coalesceHandler)
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _, _ := RunHandler("http://example.com/a", "GET", NewHeader(HeaderIfNoneMatch, `"v1"`), nil, h)
+			statuses <- status
+		}()
+	}
+
+	// Wait for all requests to join the in-flight call.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		h.group.mu.Lock()
+		c := h.group.calls["/a"]
+		joined := c != nil && c.dups == n-1
+		h.group.mu.Unlock()
+		if joined {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("requests did not coalesce")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(statuses)
+
+	if calls != 1 {
+		t.Errorf("revalidate calls=%d, want 1", calls)
+	}
+	for status := range statuses {
+		if status != StatusNotModified {
+			t.Errorf("status=%d, want %d", status, StatusNotModified)
+		}
+	}
+
+	status, _, body := RunHandler("http://example.com/a", "GET", NewHeader(HeaderIfNoneMatch, `"v0"`), nil, h)
+	if status != StatusOK || string(body) != "full" {
+		t.Errorf("changed resource, status=%d body=%q, want %d %q", status, body, StatusOK, "full")
+	}
+	if calls != 2 {
+		t.Errorf("revalidate calls=%d, want 2", calls)
+	}
+}
+
+var checkIfMatchTests = []struct {
+	ifMatch string
+	etag    string
+	done    bool
+}{
+	{"", "v1", false},
+	{"", "", false},
+	{`"v1"`, "v1", false},
+	{`"v0", "v1"`, "v1", false},
+	{`"v0"`, "v1", true},
+	{`W/"v1"`, "v1", true},
+	{"*", "v1", false},
+	{"*", "", true},
+	{`"v1"`, "", true},
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	for _, tt := range checkIfMatchTests {
+		header := NewHeader()
+		if tt.ifMatch != "" {
+			header.Set(HeaderIfMatch, tt.ifMatch)
+		}
+		req, resp := NewTestRequest("PUT", "http://example.com/", header, nil)
+		if done := req.CheckIfMatch(tt.etag); done != tt.done {
+			t.Errorf("If-Match %q, etag %q, done=%v, want %v", tt.ifMatch, tt.etag, done, tt.done)
+		}
+		status := 0
+		if tt.done {
+			status = StatusPreconditionFailed
+		}
+		if resp.Status() != status {
+			t.Errorf("If-Match %q, etag %q, status=%d, want %d", tt.ifMatch, tt.etag, resp.Status(), status)
+		}
+	}
+}
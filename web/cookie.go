@@ -17,12 +17,27 @@ package web
 import (
 	"bytes"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// addCookieValue adds the cookie with the given key and value to m. Double
+// quotes around the value are removed. Attributes from RFC 2109 cookie
+// headers such as $Version, $Path and $Domain are ignored.
+func addCookieValue(m Values, key, value string) {
+	if key[0] == '$' {
+		return
+	}
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	m.Add(key, value)
+}
+
 // parseCookieValues parses cookies from values and adds them to m. The
 // function supports the Netscape draft specification for cookies
-// (http://goo.gl/1WSx3). 
+// (http://goo.gl/1WSx3). Each element of values is the value of one Cookie
+// header.
 func parseCookieValues(values []string, m Values) error {
 	for _, s := range values {
 		key := ""
@@ -46,8 +61,7 @@ func parseCookieValues(values []string, m Values) error {
 				}
 			case ';':
 				if len(key) > 0 && begin < end {
-					value := s[begin:end]
-					m.Add(key, value)
+					addCookieValue(m, key, s[begin:end])
 				}
 				key = ""
 				begin = i + 1
@@ -57,7 +71,7 @@ func parseCookieValues(values []string, m Values) error {
 			}
 		}
 		if len(key) > 0 && begin < end {
-			m.Add(key, s[begin:end])
+			addCookieValue(m, key, s[begin:end])
 		}
 	}
 	return nil
@@ -67,9 +81,9 @@ func parseCookieValues(values []string, m Values) error {
 // 
 // Cookie supports the ancient Netscape draft specification for cookies
 // (http://goo.gl/1WSx3) and the modern HttpOnly attribute
-// (http://www.owasp.org/index.php/HttpOnly). Cookie does not attempt to
-// support any RFC for cookies because the RFCs are not supported by popular
-// browsers.
+// (http://www.owasp.org/index.php/HttpOnly) and SameSite attribute. Cookie
+// does not attempt to support any RFC for cookies because the RFCs are not
+// supported by popular browsers.
 //
 // As a convenience, the NewCookie function returns a cookie with the path
 // attribute set to "/" and the httponly attribute set to true. 
@@ -81,8 +95,16 @@ type Cookie struct {
 	maxAge   time.Duration
 	secure   bool
 	httpOnly bool
+	sameSite string
 }
 
+// Values for the SameSite cookie attribute.
+const (
+	SameSiteLax    = "Lax"
+	SameSiteStrict = "Strict"
+	SameSiteNone   = "None"
+)
+
 // NewCookie returns a new cookie with the given name and value, the path
 // attribute set to "/" and the httponly attribute set to true.
 func NewCookie(name, value string) *Cookie {
@@ -117,6 +139,14 @@ func (c *Cookie) HTTPOnly(httpOnly bool) *Cookie {
 	return c
 }
 
+// SameSite sets the SameSite attribute to one of SameSiteLax, SameSiteStrict
+// or SameSiteNone. If the value is "", then the attribute is not included in
+// the header value.
+func (c *Cookie) SameSite(sameSite string) *Cookie {
+	c.sameSite = sameSite
+	return c
+}
+
 // String renders the Set-Cookie header value as a string.
 func (c *Cookie) String() string {
 	var buf bytes.Buffer
@@ -150,5 +180,84 @@ func (c *Cookie) String() string {
 		buf.WriteString("; HttpOnly")
 	}
 
+	if c.sameSite != "" {
+		buf.WriteString("; SameSite=")
+		buf.WriteString(c.sameSite)
+	}
+
 	return buf.String()
 }
+
+// SetCookie adds the Set-Cookie header for c to the response.
+func (req *Request) SetCookie(c *Cookie) {
+	s := c.String()
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		header.Add(HeaderSetCookie, s)
+		return status, header
+	})
+}
+
+// CookiePolicy specifies attributes added to all cookies set in a response.
+type CookiePolicy struct {
+	// Add the secure attribute.
+	Secure bool
+
+	// Add the HttpOnly attribute.
+	HTTPOnly bool
+
+	// The SameSite attribute for cookies that do not specify the attribute.
+	SameSite string
+}
+
+// apply adds the attributes required by the policy to the Set-Cookie header
+// value s.
+func (p CookiePolicy) apply(s string) string {
+	var secure, httpOnly, sameSite bool
+	attrs := strings.Split(s, ";")
+	for _, attr := range attrs[1:] {
+		name := strings.TrimSpace(attr)
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = strings.TrimSpace(name[:i])
+		}
+		switch strings.ToLower(name) {
+		case "secure":
+			secure = true
+		case "httponly":
+			httpOnly = true
+		case "samesite":
+			sameSite = true
+		}
+	}
+	if p.Secure && !secure {
+		s += "; secure"
+	}
+	if p.HTTPOnly && !httpOnly {
+		s += "; HttpOnly"
+	}
+	if p.SameSite != "" && !sameSite {
+		s += "; SameSite=" + p.SameSite
+	}
+	return s
+}
+
+// CookiePolicyHandler returns a handler that applies policy to the cookies
+// set in responses from h. The policy applies to cookies set with SetCookie
+// and to Set-Cookie headers added directly by h or other middleware.
+func CookiePolicyHandler(policy CookiePolicy, h Handler) Handler {
+	return cookiePolicyHandler{policy, h}
+}
+
+type cookiePolicyHandler struct {
+	policy CookiePolicy
+	h      Handler
+}
+
+func (h cookiePolicyHandler) ServeWeb(req *Request) {
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		for i, s := range header[HeaderSetCookie] {
+			header[HeaderSetCookie][i] = h.policy.apply(s)
+		}
+		return status, header
+	})
+	h.h.ServeWeb(req)
+}
@@ -33,6 +33,10 @@ var ParseCookieValuesTests = []struct {
 	{[]string{" a=b;c=d "}, Values{"a": []string{"b"}, "c": []string{"d"}}},
 	{[]string{"a=b", "c=d"}, Values{"a": []string{"b"}, "c": []string{"d"}}},
 	{[]string{"a=b", "c=x=y"}, Values{"a": []string{"b"}, "c": []string{"x=y"}}},
+	{[]string{`a="b c"; d=""`}, Values{"a": []string{"b c"}, "d": []string{""}}},
+	{[]string{`a="b`}, Values{"a": []string{`"b`}}},
+	{[]string{"a=b; a=c", "a=d"}, Values{"a": []string{"b", "c", "d"}}},
+	{[]string{`$Version="1"; a="b"; $Path="/"; $Domain="example.com"; c=d`}, Values{"a": []string{"b"}, "c": []string{"d"}}},
 }
 
 func TestParseCookieValues(t *testing.T) {
@@ -46,3 +50,28 @@ func TestParseCookieValues(t *testing.T) {
 		}
 	}
 }
+
+func TestCookieSameSite(t *testing.T) {
+	s := NewCookie("a", "b").SameSite(SameSiteStrict).String()
+	if want := "a=b; path=/; HttpOnly; SameSite=Strict"; s != want {
+		t.Errorf("cookie=%q, want %q", s, want)
+	}
+}
+
+func TestCookiePolicyHandler(t *testing.T) {
+	policy := CookiePolicy{Secure: true, HTTPOnly: true, SameSite: SameSiteLax}
+	h := CookiePolicyHandler(policy, HandlerFunc(func(req *Request) {
+		req.SetCookie(NewCookie("a", "1").HTTPOnly(false))
+		req.SetCookie(NewCookie("b", "2").Secure(true).SameSite(SameSiteStrict))
+		req.Respond(StatusOK, HeaderSetCookie, "c=3; Path=/; httponly")
+	}))
+	_, header, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+	want := []string{
+		"c=3; Path=/; httponly; secure; SameSite=Lax",
+		"b=2; path=/; secure; HttpOnly; SameSite=Strict",
+		"a=1; path=/; secure; HttpOnly; SameSite=Lax",
+	}
+	if got := header[HeaderSetCookie]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Set-Cookie=%q, want %q", got, want)
+	}
+}
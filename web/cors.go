@@ -0,0 +1,156 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures cross-origin resource sharing.
+type CORSOptions struct {
+	// Allowed origins. An origin matches an entry if the entry equals the
+	// origin (for example "https://example.com") or the host of the origin
+	// (for example "example.com"). The entry "*" matches all origins.
+	AllowOrigins []string
+
+	// Methods allowed in cross-origin requests. If empty, then "GET", "HEAD"
+	// and "POST" are allowed.
+	AllowMethods []string
+
+	// Request headers allowed in cross-origin requests. If empty, then the
+	// headers requested in a preflight request are allowed.
+	AllowHeaders []string
+
+	// Response headers exposed to the client.
+	ExposeHeaders []string
+
+	// If true, then the client is allowed to send credentials. Credentials
+	// cannot be combined with the "*" origin because that would allow every
+	// site to make credentialed requests. CORSHandler and Router.CORS panic
+	// if AllowCredentials is true and AllowOrigins contains "*".
+	AllowCredentials bool
+
+	// Time that the client can cache the result of a preflight request. If
+	// zero, then the Access-Control-Max-Age header is not sent.
+	MaxAge time.Duration
+}
+
+var defaultCORSMethods = []string{"GET", "HEAD", "POST"}
+
+// check panics if the options allow credentials from all origins.
+func (opts *CORSOptions) check() {
+	if !opts.AllowCredentials {
+		return
+	}
+	for _, s := range opts.AllowOrigins {
+		if s == "*" {
+			panic("twister: CORS credentials not allowed with origin \"*\"")
+		}
+	}
+}
+
+// allowOrigin returns true if origin is allowed by the options.
+func (opts *CORSOptions) allowOrigin(origin string) bool {
+	host := ""
+	if u, err := url.Parse(origin); err == nil {
+		host = strings.ToLower(u.Host)
+	}
+	for _, s := range opts.AllowOrigins {
+		if s == "*" || s == origin || (host != "" && strings.ToLower(s) == host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *CORSOptions) methods() []string {
+	if len(opts.AllowMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return opts.AllowMethods
+}
+
+// setOriginHeaders sets the response headers common to preflight and actual
+// requests.
+func (opts *CORSOptions) setOriginHeaders(origin string, header Header) {
+	header.Set(HeaderAccessControlAllowOrigin, origin)
+	if opts.AllowCredentials {
+		header.Set(HeaderAccessControlAllowCredentials, "true")
+	}
+	header.Add(HeaderVary, HeaderOrigin)
+}
+
+// preflight responds to a preflight request.
+func (opts *CORSOptions) preflight(req *Request, origin string, methods []string) {
+	header := Header{}
+	opts.setOriginHeaders(origin, header)
+	header.Set(HeaderAccessControlAllowMethods, strings.Join(methods, ", "))
+	if len(opts.AllowHeaders) > 0 {
+		header.Set(HeaderAccessControlAllowHeaders, strings.Join(opts.AllowHeaders, ", "))
+	} else if s := req.Header.GetList(HeaderAccessControlRequestHeaders); len(s) > 0 {
+		header.Set(HeaderAccessControlAllowHeaders, strings.Join(s, ", "))
+	}
+	if opts.MaxAge > 0 {
+		header.Set(HeaderAccessControlMaxAge, strconv.Itoa(int(opts.MaxAge/time.Second)))
+	}
+	req.Responder.Respond(StatusNoContent, header)
+}
+
+// isPreflight returns true if the request is a CORS preflight request.
+func isPreflight(req *Request) bool {
+	return req.Method == "OPTIONS" && req.Header.Get(HeaderAccessControlRequestMethod) != ""
+}
+
+// CORSHandler returns a handler that implements cross-origin resource sharing
+// for h.
+//
+// The handler responds directly to preflight requests (OPTIONS requests with
+// an Access-Control-Request-Method header) with status 204 and the allowed
+// methods and headers. For other requests from an allowed origin, the handler
+// adds the Access-Control-Allow-Origin header to the response and dispatches
+// the request to h. Requests from origins that are not allowed are dispatched
+// to h without modification.
+func CORSHandler(opts CORSOptions, h Handler) Handler {
+	opts.check()
+	return &corsHandler{opts, h}
+}
+
+type corsHandler struct {
+	opts CORSOptions
+	h    Handler
+}
+
+func (ch *corsHandler) ServeWeb(req *Request) {
+	origin := req.Header.Get(HeaderOrigin)
+	if origin == "" || !ch.opts.allowOrigin(origin) {
+		ch.h.ServeWeb(req)
+		return
+	}
+	if isPreflight(req) {
+		ch.opts.preflight(req, origin, ch.opts.methods())
+		return
+	}
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		ch.opts.setOriginHeaders(origin, header)
+		if len(ch.opts.ExposeHeaders) > 0 {
+			header.Set(HeaderAccessControlExposeHeaders, strings.Join(ch.opts.ExposeHeaders, ", "))
+		}
+		return status, header
+	})
+	ch.h.ServeWeb(req)
+}
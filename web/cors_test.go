@@ -0,0 +1,121 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var corsTests = []struct {
+	opts           CORSOptions
+	method         string
+	requestHeader  Header
+	status         int
+	responseHeader Header
+}{
+	{
+		// Simple GET from allowed origin.
+		opts:          CORSOptions{AllowOrigins: []string{"example.com"}},
+		method:        "GET",
+		requestHeader: NewHeader(HeaderOrigin, "https://example.com"),
+		status:        StatusOK,
+		responseHeader: NewHeader(
+			HeaderAccessControlAllowOrigin, "https://example.com",
+			HeaderVary, HeaderOrigin),
+	},
+	{
+		// Simple GET with credentials and exposed headers.
+		opts: CORSOptions{
+			AllowOrigins:     []string{"https://example.com"},
+			AllowCredentials: true,
+			ExposeHeaders:    []string{"X-Total"}},
+		method:        "GET",
+		requestHeader: NewHeader(HeaderOrigin, "https://example.com"),
+		status:        StatusOK,
+		responseHeader: NewHeader(
+			HeaderAccessControlAllowOrigin, "https://example.com",
+			HeaderAccessControlAllowCredentials, "true",
+			HeaderAccessControlExposeHeaders, "X-Total",
+			HeaderVary, HeaderOrigin),
+	},
+	{
+		// Disallowed origin.
+		opts:           CORSOptions{AllowOrigins: []string{"example.com"}},
+		method:         "GET",
+		requestHeader:  NewHeader(HeaderOrigin, "https://evil.com"),
+		status:         StatusOK,
+		responseHeader: Header{},
+	},
+	{
+		// No origin.
+		opts:           CORSOptions{AllowOrigins: []string{"*"}},
+		method:         "GET",
+		status:         StatusOK,
+		responseHeader: Header{},
+	},
+	{
+		// Preflight.
+		opts: CORSOptions{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"GET", "PUT"},
+			MaxAge:       time.Hour},
+		method: "OPTIONS",
+		requestHeader: NewHeader(
+			HeaderOrigin, "https://example.com",
+			HeaderAccessControlRequestMethod, "PUT",
+			HeaderAccessControlRequestHeaders, "X-Foo, X-Bar"),
+		status: StatusNoContent,
+		responseHeader: NewHeader(
+			HeaderAccessControlAllowOrigin, "https://example.com",
+			HeaderAccessControlAllowMethods, "GET, PUT",
+			HeaderAccessControlAllowHeaders, "X-Foo, X-Bar",
+			HeaderAccessControlMaxAge, "3600",
+			HeaderVary, HeaderOrigin),
+	},
+	{
+		// OPTIONS without request method is not a preflight.
+		opts:          CORSOptions{AllowOrigins: []string{"*"}},
+		method:        "OPTIONS",
+		requestHeader: NewHeader(HeaderOrigin, "https://example.com"),
+		status:        StatusOK,
+		responseHeader: NewHeader(
+			HeaderAccessControlAllowOrigin, "https://example.com",
+			HeaderVary, HeaderOrigin),
+	},
+}
+
+func TestCORSHandler(t *testing.T) {
+	for i, tt := range corsTests {
+		h := CORSHandler(tt.opts, HandlerFunc(func(req *Request) { req.Respond(StatusOK) }))
+		status, header, _ := RunHandler("http://example.com/", tt.method, tt.requestHeader, nil, h)
+		if status != tt.status {
+			t.Errorf("test %d, status=%d, want %d", i, status, tt.status)
+		}
+		if !reflect.DeepEqual(header, tt.responseHeader) {
+			t.Errorf("test %d, header=%v, want %v", i, header, tt.responseHeader)
+		}
+	}
+}
+
+func TestCORSHandlerWildcardCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CORSHandler did not panic for credentials with origin \"*\"")
+		}
+	}()
+	CORSHandler(CORSOptions{AllowOrigins: []string{"*"}, AllowCredentials: true}, NotFoundHandler())
+}
@@ -0,0 +1,91 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+// EventStream writes server-sent events to the client. See
+// http://www.w3.org/TR/eventsource/ for information about the protocol.
+type EventStream struct {
+	w io.Writer
+}
+
+// RespondEventStream responds to the request with a server-sent event stream.
+// Proxies are asked not to cache or buffer the response.
+func (req *Request) RespondEventStream() (*EventStream, error) {
+	w := req.Respond(StatusOK,
+		HeaderContentType, "text/event-stream; charset=utf-8",
+		HeaderCacheControl, "no-cache",
+		"X-Accel-Buffering", "no")
+	s := &EventStream{w}
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *EventStream) flush() error {
+	if f, ok := s.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Send sends an event to the client and flushes the event to the network. If
+// event is "", then the event type is not sent and the client dispatches the
+// event as a "message" event. Multiline data is sent as multiple data lines.
+func (s *EventStream) Send(event, data string) error {
+	if strings.ContainsAny(event, "\r\n") {
+		return errors.New("twister: newline in event type")
+	}
+	var b bytes.Buffer
+	if event != "" {
+		b.WriteString("event: ")
+		b.WriteString(event)
+		b.WriteByte('\n')
+	}
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	if _, err := s.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// Comment sends a comment line to the client and flushes it to the network.
+// Clients ignore comments. Send comments periodically to keep idle
+// connections alive.
+func (s *EventStream) Comment(text string) error {
+	var b bytes.Buffer
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		b.WriteString(": ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	if _, err := s.w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return s.flush()
+}
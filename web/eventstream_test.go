@@ -0,0 +1,92 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testEvent struct {
+	event, data string
+}
+
+// readEvents parses an event stream.
+func readEvents(p []byte) (events []testEvent, comments []string) {
+	var ev testEvent
+	var data []string
+	s := bufio.NewScanner(bytes.NewReader(p))
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case line == "":
+			if data != nil {
+				ev.data = strings.Join(data, "\n")
+				events = append(events, ev)
+			}
+			ev = testEvent{}
+			data = nil
+		case strings.HasPrefix(line, ":"):
+			comments = append(comments, strings.TrimPrefix(line, ": "))
+		case strings.HasPrefix(line, "event: "):
+			ev.event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, line[len("data: "):])
+		}
+	}
+	return events, comments
+}
+
+func TestEventStream(t *testing.T) {
+	expected := []testEvent{
+		{"", "hello"},
+		{"update", "line 1\nline 2"},
+		{"done", ""},
+	}
+	h := HandlerFunc(func(req *Request) {
+		s, err := req.RespondEventStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, ev := range expected {
+			if err := s.Send(ev.event, ev.data); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				s.Comment("keepalive")
+			}
+		}
+		if err := s.Send("bad\nevent", "x"); err == nil {
+			t.Error("Send accepted newline in event type")
+		}
+	})
+	status, header, body := RunHandler("http://example.com/events", "GET", nil, nil, h)
+	if status != StatusOK {
+		t.Errorf("status=%d, want %d", status, StatusOK)
+	}
+	if ct := header.Get(HeaderContentType); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("content type=%q", ct)
+	}
+	events, comments := readEvents(body)
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events=%v, want %v", events, expected)
+	}
+	if !reflect.DeepEqual(comments, []string{"keepalive"}) {
+		t.Errorf("comments=%q, want keepalive", comments)
+	}
+}
@@ -39,6 +39,9 @@ var defaultServeFileOptions ServeFileOptions
 //
 // If the "v" request parameter is set, then ServeFile sets the expires header
 // and the cache control maximum age parameter to ten years in the future.
+//
+// ServeFile supports byte range requests. The If-Range header is evaluated
+// against the file's entity tag and modification time.
 func ServeFile(req *Request, fname string, options *ServeFileOptions) {
 	if options == nil {
 		options = &defaultServeFileOptions
@@ -123,9 +126,34 @@ func ServeFile(req *Request, fname string, options *ServeFileOptions) {
 		header.Set(HeaderCacheControl, strings.Join(append(parts, "max-age="+strconv.Itoa(int(maxAge/time.Second))), ", "))
 	}
 
-	w := req.Responder.Respond(status, header)
-	if req.Method != "HEAD" && status != StatusNotModified {
-		io.Copy(w, f)
+	serveContent(req, status, header, f, info.Size(), etag, info.ModTime())
+}
+
+// copyResponse copies from src to the response body w. The copy stops at the
+// first error returned from w. Errors from w are typically caused by a client
+// that closed the connection or by a client that did not read the response
+// before the server's write timeout. Unlike io.Copy, copyResponse does not
+// use io.ReaderFrom so that every write goes through the response body.
+func copyResponse(w io.Writer, src io.Reader) (written int64, err error) {
+	buf := make([]byte, 32*1024)
+	for {
+		nr, er := src.Read(buf)
+		if nr > 0 {
+			nw, ew := w.Write(buf[:nr])
+			written += int64(nw)
+			if ew != nil {
+				return written, ew
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if er == io.EOF {
+			return written, nil
+		}
+		if er != nil {
+			return written, er
+		}
 	}
 }
 
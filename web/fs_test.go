@@ -15,10 +15,12 @@
 package web
 
 import (
+	"errors"
 	"os"
 	"reflect"
 	"strconv"
 	"testing"
+	"time"
 )
 
 var testEtag = computeTestEtag()
@@ -48,6 +50,7 @@ var fileHandlerTests = []struct {
 		method: "GET",
 		status: StatusOK,
 		responseHeader: NewHeader(
+			HeaderAcceptRanges, "bytes",
 			HeaderEtag, testEtag,
 			HeaderContentLength, testContentLength),
 	},
@@ -56,6 +59,7 @@ var fileHandlerTests = []struct {
 		method: "GET",
 		status: StatusOK,
 		responseHeader: NewHeader(
+			HeaderAcceptRanges, "bytes",
 			HeaderEtag, testEtag,
 			HeaderCacheControl, "max-age=315360000",
 			HeaderContentLength, testContentLength),
@@ -67,6 +71,7 @@ var fileHandlerTests = []struct {
 		status:  StatusOK,
 		options: &ServeFileOptions{Header: NewHeader(HeaderCacheControl, "foo, max-age=2, bar")},
 		responseHeader: NewHeader(
+			HeaderAcceptRanges, "bytes",
 			HeaderEtag, testEtag,
 			HeaderCacheControl, "foo, bar, max-age=315360000",
 			HeaderContentLength, testContentLength),
@@ -77,6 +82,7 @@ var fileHandlerTests = []struct {
 		method: "HEAD",
 		status: StatusOK,
 		responseHeader: NewHeader(
+			HeaderAcceptRanges, "bytes",
 			HeaderEtag, testEtag,
 			HeaderContentLength, testContentLength),
 		noBody: true,
@@ -140,3 +146,88 @@ func TestFileHandler(t *testing.T) {
 		}
 	}
 }
+
+// closedClientWriter fails all writes after the first n bytes.
+type closedClientWriter struct {
+	n int
+}
+
+func (w *closedClientWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("broken pipe")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+// countingReader is an infinite reader that counts calls to Read.
+type countingReader struct {
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads += 1
+	return len(p), nil
+}
+
+func TestCopyResponseAbort(t *testing.T) {
+	var r countingReader
+	w := &closedClientWriter{n: 100000}
+	n, err := copyResponse(w, &r)
+	if err == nil {
+		t.Fatal("copyResponse did not return error")
+	}
+	if n != 100000 {
+		t.Errorf("written=%d, want %d", n, 100000)
+	}
+	if r.reads > 4 {
+		t.Errorf("reads=%d, copy did not stop after write error", r.reads)
+	}
+}
+
+func TestFileHandlerIfRange(t *testing.T) {
+	info, _ := os.Stat("fs_test.go")
+	modtime := info.ModTime().UTC().Format(timeLayout)
+
+	tests := []struct {
+		ifRange string
+		status  int
+	}{
+		{"", StatusPartialContent},
+		{testEtag, StatusPartialContent},
+		{`"changed"`, StatusOK},
+		{"W/" + testEtag, StatusOK},
+		{modtime, StatusPartialContent},
+		{info.ModTime().Add(-time.Hour).UTC().Format(timeLayout), StatusOK},
+	}
+
+	fh := FileHandler("fs_test.go", nil)
+	for _, tt := range tests {
+		header := NewHeader(HeaderRange, "bytes=0-9")
+		if tt.ifRange != "" {
+			header.Set(HeaderIfRange, tt.ifRange)
+		}
+		status, respHeader, body := RunHandler("http://example.com/", "GET", header, nil, fh)
+		if status != tt.status {
+			t.Errorf("If-Range %q, status=%d, want %d", tt.ifRange, status, tt.status)
+		}
+		switch status {
+		case StatusPartialContent:
+			if string(body) != "// Copyrig" {
+				t.Errorf("If-Range %q, body=%q", tt.ifRange, body)
+			}
+			if cr := respHeader.Get(HeaderContentRange); cr != "bytes 0-9/"+testContentLength {
+				t.Errorf("If-Range %q, Content-Range=%q", tt.ifRange, cr)
+			}
+			if cl := respHeader.Get(HeaderContentLength); cl != "10" {
+				t.Errorf("If-Range %q, Content-Length=%q", tt.ifRange, cl)
+			}
+		case StatusOK:
+			if respHeader.Get(HeaderContentLength) != testContentLength || strconv.Itoa(len(body)) != testContentLength {
+				t.Errorf("If-Range %q, full body not returned", tt.ifRange)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+const (
+	headerGRPCStatus  = "Grpc-Status"
+	headerGRPCMessage = "Grpc-Message"
+)
+
+// GRPCTrailer is the value of the Trailer response header for responses
+// with gRPC status trailers.
+//
+//  w := req.Respond(web.StatusOK,
+//      web.HeaderContentType, "application/grpc-web+proto",
+//      web.HeaderTrailer, web.GRPCTrailer)
+//  ... write messages to w
+//  web.SetGRPCStatus(w, 0, "")
+const GRPCTrailer = headerGRPCStatus + ", " + headerGRPCMessage
+
+// ErrTrailersNotSupported is returned when the response body does not
+// support trailers.
+var ErrTrailersNotSupported = errors.New("twister: response does not support trailers")
+
+// SetGRPCStatus sets the grpc-status and grpc-message trailers on the
+// response body w. The message is percent-encoded as specified by the gRPC
+// protocol. If message is "", then the grpc-message trailer is not set.
+func SetGRPCStatus(w io.Writer, code int, message string) error {
+	ts, ok := w.(TrailerSetter)
+	if !ok {
+		return ErrTrailersNotSupported
+	}
+	ts.SetTrailer(headerGRPCStatus, strconv.Itoa(code))
+	if message != "" {
+		ts.SetTrailer(headerGRPCMessage, encodeGRPCMessage(message))
+	}
+	return nil
+}
+
+// encodeGRPCMessage percent-encodes the bytes in s that are not printable
+// ASCII characters and the '%' character.
+func encodeGRPCMessage(s string) string {
+	const hex = "0123456789ABCDEF"
+	var p []byte
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b < 0x20 || b > 0x7e || b == '%' {
+			p = append(p, '%', hex[b>>4], hex[b&0xf])
+		} else {
+			p = append(p, b)
+		}
+	}
+	return string(p)
+}
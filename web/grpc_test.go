@@ -0,0 +1,45 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"testing"
+)
+
+var encodeGRPCMessageTests = []struct {
+	s, encoded string
+}{
+	{"", ""},
+	{"not found", "not found"},
+	{"100%", "100%25"},
+	{"line\nbreak", "line%0Abreak"},
+	{"café", "caf%C3%A9"},
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	for _, tt := range encodeGRPCMessageTests {
+		if encoded := encodeGRPCMessage(tt.s); encoded != tt.encoded {
+			t.Errorf("encodeGRPCMessage(%q) = %q, want %q", tt.s, encoded, tt.encoded)
+		}
+	}
+}
+
+func TestSetGRPCStatusNotSupported(t *testing.T) {
+	var b bytes.Buffer
+	if err := SetGRPCStatus(&b, 0, ""); err != ErrTrailersNotSupported {
+		t.Errorf("err=%v, want %v", err, ErrTrailersNotSupported)
+	}
+}
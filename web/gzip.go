@@ -0,0 +1,61 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"compress/gzip"
+	"errors"
+	"strings"
+)
+
+// GunzipRequestHandler returns a handler that decompresses request bodies
+// with Content-Encoding gzip before dispatching the request to h. The
+// Content-Encoding and Content-Length headers are removed from the request
+// and the request ContentLength is set to -1.
+//
+// Reads from the decompressed body return ErrRequestEntityTooLarge after
+// maxSize bytes to protect the application from small compressed payloads
+// that expand to very large bodies. Requests with a malformed gzip header get
+// a response with status 400 and requests with other content encodings get a
+// response with status 415.
+func GunzipRequestHandler(maxSize int64, h Handler) Handler {
+	return gunzipRequestHandler{maxSize, h}
+}
+
+type gunzipRequestHandler struct {
+	maxSize int64
+	h       Handler
+}
+
+func (h gunzipRequestHandler) ServeWeb(req *Request) {
+	encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(HeaderContentEncoding)))
+	switch encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			req.Error(StatusBadRequest, err)
+			return
+		}
+		req.Body = &maxBodyReader{r: zr, n: int(h.maxSize)}
+		req.ContentLength = -1
+		req.Header.Delete(HeaderContentEncoding)
+		req.Header.Delete(HeaderContentLength)
+	default:
+		req.Error(StatusUnsupportedMediaType, errors.New("twister: unsupported request content encoding "+encoding))
+		return
+	}
+	h.h.ServeWeb(req)
+}
@@ -0,0 +1,80 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+func gzipBytes(p []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(p)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestGunzipRequestHandler(t *testing.T) {
+	var body []byte
+	var err error
+	var header Header
+	h := GunzipRequestHandler(1<<16, HandlerFunc(func(req *Request) {
+		header = req.Header
+		body, err = ioutil.ReadAll(req.Body)
+		req.Respond(StatusOK)
+	}))
+
+	for _, tt := range []struct {
+		size int
+		err  error
+	}{
+		{1000, nil},
+		{1 << 16, nil},
+		{1<<16 + 1, ErrRequestEntityTooLarge},
+		{1 << 24, ErrRequestEntityTooLarge},
+	} {
+		p := gzipBytes(make([]byte, tt.size))
+		reqHeader := NewHeader(HeaderContentEncoding, "gzip", HeaderContentLength, strconv.Itoa(len(p)))
+		status, _, _ := RunHandler("http://example.com/", "POST", reqHeader, p, h)
+		if status != StatusOK {
+			t.Errorf("size %d, status=%d, want %d", tt.size, status, StatusOK)
+		}
+		if err != tt.err {
+			t.Errorf("size %d, err=%v, want %v", tt.size, err, tt.err)
+		}
+		if tt.err == nil && len(body) != tt.size {
+			t.Errorf("size %d, read %d bytes", tt.size, len(body))
+		}
+		if tt.err != nil && len(body) != 1<<16 {
+			t.Errorf("size %d, read %d bytes, want %d", tt.size, len(body), 1<<16)
+		}
+		if header.Get(HeaderContentEncoding) != "" || header.Get(HeaderContentLength) != "" {
+			t.Errorf("size %d, header=%v, want encoding and length removed", tt.size, header)
+		}
+	}
+
+	status, _, _ := RunHandler("http://example.com/", "POST", NewHeader(HeaderContentEncoding, "gzip"), []byte("not gzip"), h)
+	if status != StatusBadRequest {
+		t.Errorf("malformed status=%d, want %d", status, StatusBadRequest)
+	}
+	status, _, _ = RunHandler("http://example.com/", "POST", NewHeader(HeaderContentEncoding, "br"), []byte("x"), h)
+	if status != StatusUnsupportedMediaType {
+		t.Errorf("br status=%d, want %d", status, StatusUnsupportedMediaType)
+	}
+}
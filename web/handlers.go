@@ -14,7 +14,9 @@
 
 package web
 
-import ()
+import (
+	"strings"
+)
 
 type redirectHandler struct {
 	url       string
@@ -30,9 +32,84 @@ func RedirectHandler(url string, permanent bool) Handler {
 	return &redirectHandler{url, permanent}
 }
 
+type rootRedirectHandler struct {
+	url        string
+	permanent  bool
+	exactMatch bool
+}
+
+func (rh *rootRedirectHandler) ServeWeb(req *Request) {
+	if rh.exactMatch && req.URL.Path != "/" {
+		req.Error(StatusNotFound, nil)
+		return
+	}
+	req.Redirect(appendQuery(rh.url, req.URL.RawQuery), rh.permanent)
+}
+
+// RootRedirectHandler returns a request handler that redirects to the given
+// URL. The request query string is appended to the URL. If exactMatch is
+// true, then the handler only redirects requests for the path "/" and responds
+// to all other requests with 404 not found.
+//
+//  r.Register("/<path:.*>", "GET", web.RootRedirectHandler("/app", false, true))
+func RootRedirectHandler(url string, permanent bool, exactMatch bool) Handler {
+	return &rootRedirectHandler{url, permanent, exactMatch}
+}
+
+// appendQuery appends the raw query string to urlStr.
+func appendQuery(urlStr string, rawQuery string) string {
+	if rawQuery == "" {
+		return urlStr
+	}
+	fragment := ""
+	if i := strings.IndexByte(urlStr, '#'); i >= 0 {
+		urlStr, fragment = urlStr[:i], urlStr[i:]
+	}
+	switch {
+	case strings.HasSuffix(urlStr, "?") || strings.HasSuffix(urlStr, "&"):
+		urlStr += rawQuery
+	case strings.IndexByte(urlStr, '?') >= 0:
+		urlStr += "&" + rawQuery
+	default:
+		urlStr += "?" + rawQuery
+	}
+	return urlStr + fragment
+}
+
 var notFoundHandler = HandlerFunc(func(req *Request) { req.Error(StatusNotFound, nil) })
 
 // NotFoundHandler returns a request handler that responds with 404 not found.
 func NotFoundHandler() Handler {
 	return notFoundHandler
 }
+
+type spaHandler struct {
+	indexFile   string
+	apiPrefixes []string
+}
+
+func (h *spaHandler) ServeWeb(req *Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		req.Error(StatusNotFound, nil)
+		return
+	}
+	for _, prefix := range h.apiPrefixes {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			req.Error(StatusNotFound, nil)
+			return
+		}
+	}
+	ServeFile(req, h.indexFile, nil)
+}
+
+// SPAHandler returns a request handler for single-page applications. The
+// handler responds to GET and HEAD requests with the contents of indexFile so
+// that the client application can route the request. Requests with a path
+// starting with one of apiPrefixes and requests using other methods get a 404
+// response. Register the handler as the last route in a router to use it as
+// the fallback for unmatched paths:
+//
+//  r.Register("/<path:.*>", "*", web.SPAHandler("static/index.html", []string{"/api/"}))
+func SPAHandler(indexFile string, apiPrefixes []string) Handler {
+	return &spaHandler{indexFile, apiPrefixes}
+}
@@ -0,0 +1,107 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const spaTestIndex = "<html>index</html>"
+
+var spaHandlerTests = []struct {
+	url    string
+	method string
+	status int
+	body   string
+}{
+	{url: "/", method: "GET", status: StatusOK, body: spaTestIndex},
+	{url: "/users/42/edit", method: "GET", status: StatusOK, body: spaTestIndex},
+	{url: "/users/42/edit", method: "HEAD", status: StatusOK},
+	{url: "/api/users/42", method: "GET", status: StatusNotFound},
+	{url: "/users/42", method: "POST", status: StatusNotFound},
+	{url: "/api/users", method: "GET", status: StatusOK, body: "api"},
+}
+
+func TestSPAHandler(t *testing.T) {
+	f, err := ioutil.TempFile("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(spaTestIndex)
+	f.Close()
+
+	r := NewRouter()
+	r.Register("/api/users", "GET", routeTestHandler("api"))
+	r.Register("/<path:.*>", "*", SPAHandler(f.Name(), []string{"/api/"}))
+
+	for _, tt := range spaHandlerTests {
+		status, _, body := RunHandler(tt.url, tt.method, nil, nil, r)
+		if status != tt.status {
+			t.Errorf("%s %s, status=%d, want %d", tt.method, tt.url, status, tt.status)
+		}
+		if status == StatusOK && string(body) != tt.body {
+			t.Errorf("%s %s, body=%q, want %q", tt.method, tt.url, body, tt.body)
+		}
+	}
+}
+
+var rootRedirectHandlerTests = []struct {
+	url        string
+	exactMatch bool
+	status     int
+	location   string
+}{
+	{url: "/", status: StatusFound, location: "/app"},
+	{url: "/?a=1", status: StatusFound, location: "/app?a=1"},
+	{url: "/?a=1&b=2", status: StatusFound, location: "/app?a=1&b=2"},
+	{url: "/foo?a=1", status: StatusFound, location: "/app?a=1"},
+	{url: "/?a=1", exactMatch: true, status: StatusFound, location: "/app?a=1"},
+	{url: "/foo?a=1", exactMatch: true, status: StatusNotFound},
+}
+
+func TestRootRedirectHandler(t *testing.T) {
+	for _, tt := range rootRedirectHandlerTests {
+		h := RootRedirectHandler("/app", false, tt.exactMatch)
+		status, header, _ := RunHandler(tt.url, "GET", nil, nil, h)
+		if status != tt.status {
+			t.Errorf("%s exact=%v, status=%d, want %d", tt.url, tt.exactMatch, status, tt.status)
+		}
+		if location := header.Get(HeaderLocation); location != tt.location {
+			t.Errorf("%s exact=%v, location=%q, want %q", tt.url, tt.exactMatch, location, tt.location)
+		}
+	}
+}
+
+var appendQueryTests = []struct {
+	url, query, result string
+}{
+	{"/app", "", "/app"},
+	{"/app", "a=1", "/app?a=1"},
+	{"/app?b=2", "a=1", "/app?b=2&a=1"},
+	{"/app?", "a=1", "/app?a=1"},
+	{"/app#top", "a=1", "/app?a=1#top"},
+	{"http://example.com/app?b=2#top", "a=1", "http://example.com/app?b=2&a=1#top"},
+}
+
+func TestAppendQuery(t *testing.T) {
+	for _, tt := range appendQueryTests {
+		if result := appendQuery(tt.url, tt.query); result != tt.result {
+			t.Errorf("appendQuery(%q, %q) = %q, want %q", tt.url, tt.query, result, tt.result)
+		}
+	}
+}
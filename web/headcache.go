@@ -0,0 +1,198 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headCacheMaxEntries is the maximum number of entries in a HeadCacheHandler
+// cache.
+const headCacheMaxEntries = 1024
+
+// HeadCacheHandler returns a handler that answers HEAD requests from the
+// headers of an earlier response to a GET request for the same URL. This
+// avoids running an expensive GET handler to compute the Content-Length of a
+// HEAD response.
+//
+// The cache is keyed by the URL and ETag of the GET response. Only
+// successful GET responses with an ETag header are cached. Responses with a
+// Vary or Set-Cookie header or with Cache-Control private or no-store are not
+// cached, nor are responses to requests with an Authorization header. Each
+// cached GET response replaces the cache entry for the URL so that the entry
+// follows changes to the ETag. Hop-by-hop headers are not cached. Entries
+// expire after maxAge. HEAD requests with an Authorization header or for URLs
+// without a cache entry are dispatched to h.
+func HeadCacheHandler(maxAge time.Duration, h Handler) Handler {
+	return &headCacheHandler{
+		maxAge:  maxAge,
+		h:       h,
+		etags:   make(map[string]string),
+		entries: make(map[string]*headCacheEntry),
+	}
+}
+
+type headCacheEntry struct {
+	url        string
+	header     Header
+	expiration time.Time
+}
+
+type headCacheHandler struct {
+	maxAge time.Duration
+	h      Handler
+
+	mu sync.Mutex
+	// etags maps a URL to the ETag of the latest cached GET response.
+	etags map[string]string
+	// entries maps a URL and ETag to the cached headers.
+	entries map[string]*headCacheEntry
+}
+
+func headCacheKey(url, etag string) string {
+	return url + " " + etag
+}
+
+func (hc *headCacheHandler) delete(key string, e *headCacheEntry) {
+	delete(hc.entries, key)
+	if headCacheKey(e.url, hc.etags[e.url]) == key {
+		delete(hc.etags, e.url)
+	}
+}
+
+func (hc *headCacheHandler) get(url string, now time.Time) *headCacheEntry {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	etag, found := hc.etags[url]
+	if !found {
+		return nil
+	}
+	key := headCacheKey(url, etag)
+	e := hc.entries[key]
+	if e != nil && !now.Before(e.expiration) {
+		hc.delete(key, e)
+		e = nil
+	}
+	return e
+}
+
+// remove removes the entry for url.
+func (hc *headCacheHandler) remove(url string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if etag, found := hc.etags[url]; found {
+		delete(hc.entries, headCacheKey(url, etag))
+		delete(hc.etags, url)
+	}
+}
+
+func (hc *headCacheHandler) put(url, etag string, e *headCacheEntry, now time.Time) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if old, found := hc.etags[url]; found {
+		delete(hc.entries, headCacheKey(url, old))
+		delete(hc.etags, url)
+	}
+	if len(hc.entries) >= headCacheMaxEntries {
+		for k, e := range hc.entries {
+			if !now.Before(e.expiration) {
+				hc.delete(k, e)
+			}
+		}
+		if len(hc.entries) >= headCacheMaxEntries {
+			return
+		}
+	}
+	hc.etags[url] = etag
+	hc.entries[headCacheKey(url, etag)] = e
+}
+
+// hopHeaders are the hop-by-hop headers. The server adds framing headers such
+// as Transfer-Encoding to the response header when the response is sent.
+var hopHeaders = []string{
+	HeaderConnection,
+	HeaderKeepAlive,
+	HeaderProxyAuthenticate,
+	HeaderProxyAuthorization,
+	HeaderTE,
+	HeaderTrailer,
+	HeaderTransferEncoding,
+	HeaderUpgrade,
+}
+
+// removeHopHeaders removes the hop-by-hop headers and the headers named in
+// the Connection header from header.
+func removeHopHeaders(header Header) {
+	for _, key := range header.GetList(HeaderConnection) {
+		header.Delete(HeaderName(key))
+	}
+	for _, key := range hopHeaders {
+		header.Delete(key)
+	}
+}
+
+// cacheable returns true if the headers of the GET response can be shared
+// with other clients.
+func cacheable(req *Request, header Header) bool {
+	if req.Header.Get(HeaderAuthorization) != "" ||
+		header.Get(HeaderVary) != "" ||
+		header.Get(HeaderSetCookie) != "" {
+		return false
+	}
+	for _, directive := range header.GetList(HeaderCacheControl) {
+		directive = strings.ToLower(directive)
+		if i := strings.IndexByte(directive, '='); i >= 0 {
+			directive = strings.TrimSpace(directive[:i])
+		}
+		if directive == "private" || directive == "no-store" {
+			return false
+		}
+	}
+	return true
+}
+
+func (hc *headCacheHandler) ServeWeb(req *Request) {
+	url := req.URL.String()
+	switch req.Method {
+	case "HEAD":
+		if req.Header.Get(HeaderAuthorization) == "" {
+			if e := hc.get(url, nowFunc()); e != nil {
+				req.Responder.Respond(StatusOK, copyHeader(e.header))
+				return
+			}
+		}
+		hc.h.ServeWeb(req)
+	case "GET":
+		var info *ResponseInfo
+		req.Responder, info = WrapResponder(req.Responder)
+		hc.h.ServeWeb(req)
+		etag := info.Header().Get(HeaderETag)
+		if info.Status() != StatusOK || etag == "" || !cacheable(req, info.Header()) {
+			// Do not answer HEAD requests from an older response.
+			hc.remove(url)
+			return
+		}
+		header := copyHeader(info.Header())
+		removeHopHeaders(header)
+		header.Set(HeaderContentLength, strconv.FormatInt(info.Size(), 10))
+		now := nowFunc()
+		hc.put(url, etag, &headCacheEntry{url: url, header: header, expiration: now.Add(hc.maxAge)}, now)
+	default:
+		hc.h.ServeWeb(req)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestHeadCacheHandler(t *testing.T) {
+	now := time.Unix(1300000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	calls := 0
+	body := "hello"
+	h := HeadCacheHandler(time.Minute, HandlerFunc(func(req *Request) {
+		calls += 1
+		w := req.Respond(StatusOK, HeaderETag, `"`+body+`"`, HeaderContentType, "text/plain",
+			HeaderTransferEncoding, "chunked", HeaderConnection, "keep-alive, X-Hop", "X-Hop", "1")
+		if req.Method == "GET" {
+			io.WriteString(w, body)
+		}
+	}))
+	head := func() Header {
+		_, header, _ := RunHandler("http://example.com/a", "HEAD", nil, nil, h)
+		return header
+	}
+
+	// HEAD without a cached GET runs the handler.
+	head()
+	if calls != 1 {
+		t.Errorf("calls=%d, want 1", calls)
+	}
+
+	RunHandler("http://example.com/a", "GET", nil, nil, h)
+	calls = 0
+	header := head()
+	if calls != 0 {
+		t.Errorf("HEAD after GET, calls=%d, want 0", calls)
+	}
+	if cl := header.Get(HeaderContentLength); cl != "5" {
+		t.Errorf("Content-Length=%q, want 5", cl)
+	}
+	if etag := header.Get(HeaderETag); etag != `"hello"` {
+		t.Errorf("ETag=%q, want %q", etag, `"hello"`)
+	}
+	for _, key := range []string{HeaderTransferEncoding, HeaderConnection, "X-Hop"} {
+		if v := header.Get(key); v != "" {
+			t.Errorf("%s=%q, want removed", key, v)
+		}
+	}
+
+	// A GET with a new ETag replaces the entry.
+	body = "hello, world"
+	RunHandler("http://example.com/a", "GET", nil, nil, h)
+	if cl := head().Get(HeaderContentLength); cl != "12" {
+		t.Errorf("after change, Content-Length=%q, want 12", cl)
+	}
+
+	// Entries expire.
+	now = now.Add(2 * time.Minute)
+	calls = 0
+	head()
+	if calls != 1 {
+		t.Errorf("after expiration, calls=%d, want 1", calls)
+	}
+}
+
+func TestHeadCacheHandlerPrivate(t *testing.T) {
+	for _, tt := range []struct {
+		reqHeader  Header
+		respHeader []string
+	}{
+		{nil, []string{HeaderVary, "Accept-Encoding"}},
+		{nil, []string{HeaderSetCookie, "id=1"}},
+		{nil, []string{HeaderCacheControl, "max-age=60, private"}},
+		{nil, []string{HeaderCacheControl, "no-store"}},
+		{NewHeader(HeaderAuthorization, "Basic dXNlcjpwYXNz"), nil},
+	} {
+		calls := 0
+		h := HeadCacheHandler(time.Minute, HandlerFunc(func(req *Request) {
+			calls += 1
+			w := req.Respond(StatusOK, append([]string{HeaderETag, `"x"`}, tt.respHeader...)...)
+			if req.Method == "GET" {
+				io.WriteString(w, "hello")
+			}
+		}))
+		RunHandler("http://example.com/a", "GET", tt.reqHeader, nil, h)
+		RunHandler("http://example.com/a", "HEAD", nil, nil, h)
+		if calls != 2 {
+			t.Errorf("request %v, response %v, calls=%d, want HEAD handled by h", tt.reqHeader, tt.respHeader, calls)
+		}
+	}
+}
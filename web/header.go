@@ -103,6 +103,19 @@ func (m Header) Get(key string) string {
 	return values[0]
 }
 
+// Delete removes the values for the given key. Delete does nothing if the key
+// is not present.
+func (m Header) Delete(key string) {
+	delete(m, key)
+}
+
+// Clear removes all keys from the header.
+func (m Header) Clear() {
+	for key := range m {
+		delete(m, key)
+	}
+}
+
 // GetValueParam returns a value and optional semi-colon prefixed name-value
 // pairs for header with name key. The value and parameter keys are converted
 // to lowercase. All whitespace is trimmed. This format is used by the
@@ -196,8 +209,24 @@ func (m Header) GetAccept(key string) []ValueParams {
 	return result
 }
 
-// WriteHttpHeader writes the map in HTTP header format.
+// WriteHttpHeader writes the map in HTTP header format followed by the blank
+// line that terminates the header.
 func (m Header) WriteHttpHeader(w io.Writer) error {
+	if err := m.writeFields(w, false); err != nil {
+		return err
+	}
+	_, err := w.Write(crlfBytes)
+	return err
+}
+
+// WriteHttpHeaderFields writes the map in HTTP header format without the
+// terminating blank line. Header names are converted to canonical format.
+// Keys with multiple values are written as multiple header lines.
+func (m Header) WriteHttpHeaderFields(w io.Writer) error {
+	return m.writeFields(w, true)
+}
+
+func (m Header) writeFields(w io.Writer, canonical bool) error {
 	keys := make([]string, 0, len(m))
 	for key := range m {
 		keys = append(keys, key)
@@ -206,6 +235,9 @@ func (m Header) WriteHttpHeader(w io.Writer) error {
 
 	for _, key := range keys {
 		keyBytes := []byte(key)
+		if canonical {
+			keyBytes = []byte(HeaderName(key))
+		}
 		for _, value := range m[key] {
 			if _, err := w.Write(keyBytes); err != nil {
 				return err
@@ -229,8 +261,7 @@ func (m Header) WriteHttpHeader(w io.Writer) error {
 			}
 		}
 	}
-	_, err := w.Write(crlfBytes)
-	return err
+	return nil
 }
 
 // ParseHttpHeader parses the HTTP headers and appends the values to the
@@ -347,59 +378,81 @@ func trimBytes(p []byte) []byte {
 
 // Header names in canonical format.
 const (
-	HeaderAccept             = "Accept"
-	HeaderAcceptCharset      = "Accept-Charset"
-	HeaderAcceptEncoding     = "Accept-Encoding"
-	HeaderAcceptLanguage     = "Accept-Language"
-	HeaderAcceptRanges       = "Accept-Ranges"
-	HeaderAge                = "Age"
-	HeaderAllow              = "Allow"
-	HeaderAuthorization      = "Authorization"
-	HeaderCacheControl       = "Cache-Control"
-	HeaderConnection         = "Connection"
-	HeaderContentDisposition = "Content-Disposition"
-	HeaderContentEncoding    = "Content-Encoding"
-	HeaderContentLanguage    = "Content-Language"
-	HeaderContentLength      = "Content-Length"
-	HeaderContentLocation    = "Content-Location"
-	HeaderContentMD5         = "Content-Md5"
-	HeaderContentRange       = "Content-Range"
-	HeaderContentType        = "Content-Type"
-	HeaderCookie             = "Cookie"
-	HeaderDate               = "Date"
-	HeaderETag               = "Etag"
-	HeaderEtag               = "Etag"
-	HeaderExpect             = "Expect"
-	HeaderExpires            = "Expires"
-	HeaderFrom               = "From"
-	HeaderHost               = "Host"
-	HeaderIfMatch            = "If-Match"
-	HeaderIfModifiedSince    = "If-Modified-Since"
-	HeaderIfNoneMatch        = "If-None-Match"
-	HeaderIfRange            = "If-Range"
-	HeaderIfUnmodifiedSince  = "If-Unmodified-Since"
-	HeaderLastModified       = "Last-Modified"
-	HeaderLocation           = "Location"
-	HeaderMaxForwards        = "Max-Forwards"
-	HeaderOrigin             = "Origin"
-	HeaderPragma             = "Pragma"
-	HeaderProxyAuthenticate  = "Proxy-Authenticate"
-	HeaderProxyAuthorization = "Proxy-Authorization"
-	HeaderRange              = "Range"
-	HeaderReferer            = "Referer"
-	HeaderRetryAfter         = "Retry-After"
-	HeaderServer             = "Server"
-	HeaderSetCookie          = "Set-Cookie"
-	HeaderTE                 = "Te"
-	HeaderTrailer            = "Trailer"
-	HeaderTransferEncoding   = "Transfer-Encoding"
-	HeaderUpgrade            = "Upgrade"
-	HeaderUserAgent          = "User-Agent"
-	HeaderVary               = "Vary"
-	HeaderVia                = "Via"
-	HeaderWWWAuthenticate    = "Www-Authenticate"
-	HeaderWarning            = "Warning"
-	HeaderXXSRFToken         = "X-Xsrftoken"
+	HeaderAccept                        = "Accept"
+	HeaderAcceptCharset                 = "Accept-Charset"
+	HeaderAcceptEncoding                = "Accept-Encoding"
+	HeaderAcceptLanguage                = "Accept-Language"
+	HeaderAcceptRanges                  = "Accept-Ranges"
+	HeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HeaderAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+	HeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
+	HeaderAge                           = "Age"
+	HeaderAllow                         = "Allow"
+	HeaderAuthorization                 = "Authorization"
+	HeaderCacheControl                  = "Cache-Control"
+	HeaderConnection                    = "Connection"
+	HeaderContentDisposition            = "Content-Disposition"
+	HeaderContentEncoding               = "Content-Encoding"
+	HeaderContentLanguage               = "Content-Language"
+	HeaderContentLength                 = "Content-Length"
+	HeaderContentLocation               = "Content-Location"
+	HeaderContentMD5                    = "Content-Md5"
+	HeaderContentRange                  = "Content-Range"
+	HeaderContentType                   = "Content-Type"
+	HeaderCookie                        = "Cookie"
+	HeaderDate                          = "Date"
+	HeaderETag                          = "Etag"
+	HeaderEtag                          = "Etag"
+	HeaderExpect                        = "Expect"
+	HeaderExpires                       = "Expires"
+	HeaderFrom                          = "From"
+	HeaderHost                          = "Host"
+	HeaderIfMatch                       = "If-Match"
+	HeaderIfModifiedSince               = "If-Modified-Since"
+	HeaderIfNoneMatch                   = "If-None-Match"
+	HeaderIfRange                       = "If-Range"
+	HeaderIfUnmodifiedSince             = "If-Unmodified-Since"
+	HeaderKeepAlive                     = "Keep-Alive"
+	HeaderLastModified                  = "Last-Modified"
+	HeaderLink                          = "Link"
+	HeaderLocation                      = "Location"
+	HeaderMaxForwards                   = "Max-Forwards"
+	HeaderOrigin                        = "Origin"
+	HeaderPermissionsPolicy             = "Permissions-Policy"
+	HeaderPragma                        = "Pragma"
+	HeaderProxyAuthenticate             = "Proxy-Authenticate"
+	HeaderProxyAuthorization            = "Proxy-Authorization"
+	HeaderRange                         = "Range"
+	HeaderReferer                       = "Referer"
+	HeaderReferrerPolicy                = "Referrer-Policy"
+	HeaderRetryAfter                    = "Retry-After"
+	HeaderSecWebSocketAccept            = "Sec-Websocket-Accept"
+	HeaderSecWebSocketKey               = "Sec-Websocket-Key"
+	HeaderSecWebSocketVersion           = "Sec-Websocket-Version"
+	HeaderServer                        = "Server"
+	HeaderSetCookie                     = "Set-Cookie"
+	HeaderStrictTransportSecurity       = "Strict-Transport-Security"
+	HeaderTE                            = "Te"
+	HeaderTrailer                       = "Trailer"
+	HeaderTransferEncoding              = "Transfer-Encoding"
+	HeaderUpgrade                       = "Upgrade"
+	HeaderUserAgent                     = "User-Agent"
+	HeaderVary                          = "Vary"
+	HeaderVia                           = "Via"
+	HeaderWWWAuthenticate               = "Www-Authenticate"
+	HeaderWarning                       = "Warning"
+	HeaderXContentTypeOptions           = "X-Content-Type-Options"
+	HeaderXForwardedFor                 = "X-Forwarded-For"
+	HeaderXForwardedProto               = "X-Forwarded-Proto"
+	HeaderXFrameOptions                 = "X-Frame-Options"
+	HeaderXHTTPMethodOverride           = "X-Http-Method-Override"
+	HeaderXRequestId                    = "X-Request-Id"
+	HeaderXXSRFToken                    = "X-Xsrftoken"
 )
 
 // HeaderName returns the canonical format of the header name. 
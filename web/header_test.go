@@ -18,6 +18,7 @@ import (
 	"bufio"
 	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -184,3 +185,47 @@ func TestGetAccept(t *testing.T) {
 		}
 	}
 }
+
+func TestHeaderDelete(t *testing.T) {
+	h := NewHeader(HeaderConnection, "close", HeaderContentType, "text/plain")
+	h.Delete(HeaderConnection)
+	h.Delete(HeaderUpgrade)
+	if v := h.Get(HeaderConnection); v != "" {
+		t.Errorf("Get(Connection) after delete = %q", v)
+	}
+	if v := h.Get(HeaderContentType); v != "text/plain" {
+		t.Errorf("Get(Content-Type) = %q", v)
+	}
+	h.Clear()
+	if len(h) != 0 {
+		t.Errorf("len after clear = %d", len(h))
+	}
+}
+
+var writeHttpHeaderFieldsTests = []struct {
+	header Header
+	out    string
+}{
+	{Header{}, ""},
+	{NewHeader("content-type", "text/plain"), "Content-Type: text/plain\r\n"},
+	{NewHeader(HeaderSetCookie, "a=1", HeaderSetCookie, "b=2", HeaderContentLength, "0"),
+		"Content-Length: 0\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n"},
+	{NewHeader(HeaderLocation, "/a\r\nX-Injected: 1"), "Location: /a  X-Injected: 1\r\n"},
+}
+
+func TestWriteHttpHeaderFields(t *testing.T) {
+	for _, tt := range writeHttpHeaderFieldsTests {
+		var b bytes.Buffer
+		if err := tt.header.WriteHttpHeaderFields(&b); err != nil {
+			t.Errorf("%v, err=%v", tt.header, err)
+		}
+		if b.String() != tt.out {
+			t.Errorf("%v, out=%q, want %q", tt.header, b.String(), tt.out)
+		}
+		b.Reset()
+		tt.header.WriteHttpHeader(&b)
+		if !strings.HasSuffix(b.String(), "\r\n") || len(b.String()) != len(tt.out)+2 {
+			t.Errorf("%v, WriteHttpHeader out=%q, want fields and terminator", tt.header, b.String())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// HTTPError is an error with an HTTP status, a machine-readable code and a
+// message for the client. The default error handler renders an HTTPError as
+// a JSON object if the client prefers JSON and as plain text otherwise:
+//
+//  {"status":404,"code":"user_not_found","message":"No such user."}
+type HTTPError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewHTTPError returns a new HTTPError.
+func NewHTTPError(status int, code, message string) *HTTPError {
+	return &HTTPError{Status: status, Code: code, Message: message}
+}
+
+func (e *HTTPError) Error() string {
+	s := strconv.Itoa(e.Status)
+	if e.Code != "" {
+		s += " " + e.Code
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return "twister: " + s
+}
+
+// FailWith responds to the request with the error using the request's error
+// handler.
+func (req *Request) FailWith(err *HTTPError) {
+	req.ErrorHandler(req, err.Status, err, NewHeader())
+}
+
+// respondHTTPError renders e as JSON or plain text depending on the request's
+// Accept header.
+func respondHTTPError(req *Request, e *HTTPError, header Header) {
+	if req.Accepts("text/plain", "application/json") == "application/json" {
+		p, _ := json.Marshal(e)
+		header.Set(HeaderContentType, ContentTypeJSON)
+		req.Responder.Respond(e.Status, header).Write(p)
+	} else {
+		text := e.Message
+		if text == "" {
+			text = StatusText(e.Status)
+		}
+		header.Set(HeaderContentType, "text/plain; charset=utf-8")
+		io.WriteString(req.Responder.Respond(e.Status, header), text)
+	}
+	if e.Status >= 500 {
+		log.Println("ERROR", req.URL, e.Status, e)
+	}
+}
+
+// ValidationErrors maps field names to messages describing why the field
+// value is not valid.
+type ValidationErrors map[string][]string
+
+// Add adds a message for field.
+func (ve ValidationErrors) Add(field, message string) {
+	ve[field] = append(ve[field], message)
+}
+
+// text returns the errors as lines of text sorted by field.
+func (ve ValidationErrors) text() string {
+	fields := make([]string, 0, len(ve))
+	for field := range ve {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var buf bytes.Buffer
+	for _, field := range fields {
+		for _, message := range ve[field] {
+			buf.WriteString(field)
+			buf.WriteString(": ")
+			buf.WriteString(message)
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
+
+func (ve ValidationErrors) Error() string {
+	return "twister: validation failed\n" + ve.text()
+}
+
+// FailValidation responds to the request with status 422 and the field
+// errors in ve. The errors are rendered as a JSON object if the client
+// prefers JSON and as plain text otherwise:
+//
+//  {"status":422,"errors":{"email":["Required."],"age":["Must be a number."]}}
+func (req *Request) FailValidation(ve ValidationErrors) {
+	if req.Accepts("text/plain", "application/json") == "application/json" {
+		p, _ := json.Marshal(struct {
+			Status int              `json:"status"`
+			Errors ValidationErrors `json:"errors"`
+		}{StatusUnprocessableEntity, ve})
+		req.Respond(StatusUnprocessableEntity, HeaderContentType, ContentTypeJSON).Write(p)
+	} else {
+		io.WriteString(req.Respond(StatusUnprocessableEntity, HeaderContentType, "text/plain; charset=utf-8"), ve.text())
+	}
+}
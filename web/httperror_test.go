@@ -0,0 +1,85 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"testing"
+)
+
+var failWithTests = []struct {
+	accept      string
+	contentType string
+	body        string
+}{
+	{"", "text/plain; charset=utf-8", "No such user."},
+	{"application/json", ContentTypeJSON, `{"status":404,"code":"user_not_found","message":"No such user."}`},
+	{"text/html, application/json;q=0.9, */*;q=0.1", ContentTypeJSON, `{"status":404,"code":"user_not_found","message":"No such user."}`},
+	{"text/plain, application/json;q=0.5", "text/plain; charset=utf-8", "No such user."},
+}
+
+func TestFailWith(t *testing.T) {
+	h := HandlerFunc(func(req *Request) {
+		req.FailWith(NewHTTPError(StatusNotFound, "user_not_found", "No such user."))
+	})
+	for _, tt := range failWithTests {
+		var header Header
+		if tt.accept != "" {
+			header = NewHeader(HeaderAccept, tt.accept)
+		}
+		status, respHeader, body := RunHandler("http://example.com/users/1", "GET", header, nil, h)
+		if status != StatusNotFound {
+			t.Errorf("accept %q, status=%d, want %d", tt.accept, status, StatusNotFound)
+		}
+		if ct := respHeader.Get(HeaderContentType); ct != tt.contentType {
+			t.Errorf("accept %q, content type=%q, want %q", tt.accept, ct, tt.contentType)
+		}
+		if string(body) != tt.body {
+			t.Errorf("accept %q, body=%q, want %q", tt.accept, body, tt.body)
+		}
+	}
+}
+
+func TestFailValidation(t *testing.T) {
+	h := HandlerFunc(func(req *Request) {
+		ve := make(ValidationErrors)
+		ve.Add("name", "Required.")
+		ve.Add("email", "Required.")
+		ve.Add("email", "Must be an email address.")
+		req.FailValidation(ve)
+	})
+	for _, tt := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"application/json", ContentTypeJSON, `{"status":422,"errors":{"email":["Required.","Must be an email address."],"name":["Required."]}}`},
+		{"", "text/plain; charset=utf-8", "email: Required.\nemail: Must be an email address.\nname: Required.\n"},
+	} {
+		var header Header
+		if tt.accept != "" {
+			header = NewHeader(HeaderAccept, tt.accept)
+		}
+		status, respHeader, body := RunHandler("http://example.com/signup", "POST", header, nil, h)
+		if status != StatusUnprocessableEntity {
+			t.Errorf("accept %q, status=%d, want %d", tt.accept, status, StatusUnprocessableEntity)
+		}
+		if ct := respHeader.Get(HeaderContentType); ct != tt.contentType {
+			t.Errorf("accept %q, content type=%q, want %q", tt.accept, ct, tt.contentType)
+		}
+		if string(body) != tt.body {
+			t.Errorf("accept %q, body=%q, want %q", tt.accept, body, tt.body)
+		}
+	}
+}
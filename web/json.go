@@ -0,0 +1,128 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ContentTypeJSON is the content type for UTF-8 encoded JSON.
+const ContentTypeJSON = "application/json; charset=utf-8"
+
+// MaxJSONBodyLen is the maximum length of a request body read by DecodeJSON.
+const MaxJSONBodyLen = 1 << 20
+
+// ErrNotJSON is returned by DecodeJSON when the request content type is not
+// JSON.
+var ErrNotJSON = errors.New("twister: request content type not JSON")
+
+// isJSONContentType returns true if the lowercase content type ct is a JSON
+// media type.
+func isJSONContentType(ct string) bool {
+	return ct == "application/json" || (strings.HasPrefix(ct, "application/") && strings.HasSuffix(ct, "+json"))
+}
+
+// DecodeJSON decodes the JSON request body to v. DecodeJSON returns
+// ErrNotJSON if the request content type is not a JSON type and
+// ErrRequestEntityTooLarge if the body is longer than MaxJSONBodyLen.
+func (req *Request) DecodeJSON(v interface{}) error {
+	return req.decodeJSON(v, MaxJSONBodyLen)
+}
+
+func (req *Request) decodeJSON(v interface{}, maxLen int) error {
+	if !isJSONContentType(req.ContentType) {
+		return ErrNotJSON
+	}
+	p, err := req.BodyBytes(maxLen)
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		return errors.New("twister: empty JSON request body")
+	}
+	if err := json.Unmarshal(p, v); err != nil {
+		return errors.New("twister: malformed JSON request body, " + err.Error())
+	}
+	return nil
+}
+
+// RespondJSON responds to the request with the JSON encoding of v. The
+// Content-Type and Content-Length headers are set from the encoded value. If
+// v cannot be encoded, then RespondJSON responds with status 500 and returns
+// the encoding error.
+func (req *Request) RespondJSON(status int, v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		req.Error(StatusInternalServerError, err)
+		return err
+	}
+	w := req.Respond(status,
+		HeaderContentType, ContentTypeJSON,
+		HeaderContentLength, strconv.Itoa(len(p)))
+	if _, err := w.Write(p); err != nil {
+		return err
+	}
+	if f, ok := w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// JSONHandler returns a handler that decodes the JSON request body to a new
+// value with the type of v and calls fn with the request and a pointer to the
+// new value. The value v is used only to determine the type; v can be a value
+// or a pointer to a value:
+//
+//  web.JSONHandler(&Item{}, func(req *web.Request, v interface{}) {
+//      item := v.(*Item)
+//      ...
+//  })
+//
+// The handler responds with status 415 if the request content type is not a
+// JSON type, status 413 if the body is longer than MaxJSONBodyLen and status
+// 400 if the body is not valid JSON for the type.
+func JSONHandler(v interface{}, fn func(*Request, interface{})) Handler {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		panic("twister: JSONHandler value is nil")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return jsonHandler{t, fn}
+}
+
+type jsonHandler struct {
+	t  reflect.Type
+	fn func(*Request, interface{})
+}
+
+func (h jsonHandler) ServeWeb(req *Request) {
+	v := reflect.New(h.t).Interface()
+	switch err := req.DecodeJSON(v); err {
+	case nil:
+		h.fn(req, v)
+	case ErrNotJSON:
+		req.Error(StatusUnsupportedMediaType, err)
+	case ErrRequestEntityTooLarge:
+		req.Error(StatusRequestEntityTooLarge, err)
+	default:
+		req.Error(StatusBadRequest, err)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"strconv"
+	"testing"
+)
+
+var respondJSONTests = []struct {
+	v      interface{}
+	status int
+	body   string
+	err    bool
+}{
+	{
+		v: struct {
+			Name  string `json:"name"`
+			Count int    `json:"count"`
+		}{"gopher", 3},
+		status: StatusOK,
+		body:   `{"name":"gopher","count":3}`,
+	},
+	{
+		v:      map[string]int{"a": 1, "b": 2},
+		status: StatusOK,
+		body:   `{"a":1,"b":2}`,
+	},
+	{
+		v:      make(chan int),
+		status: StatusInternalServerError,
+		err:    true,
+	},
+}
+
+func TestRespondJSON(t *testing.T) {
+	for i, tt := range respondJSONTests {
+		var err error
+		h := HandlerFunc(func(req *Request) { err = req.RespondJSON(StatusOK, tt.v) })
+		status, header, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+		if status != tt.status {
+			t.Errorf("test %d, status=%d, want %d", i, status, tt.status)
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("test %d, err=%v, want error %v", i, err, tt.err)
+		}
+		if tt.err {
+			continue
+		}
+		if string(body) != tt.body {
+			t.Errorf("test %d, body=%q, want %q", i, body, tt.body)
+		}
+		if ct := header.Get(HeaderContentType); ct != ContentTypeJSON {
+			t.Errorf("test %d, content type=%q, want %q", i, ct, ContentTypeJSON)
+		}
+		if cl := header.Get(HeaderContentLength); cl != strconv.Itoa(len(body)) {
+			t.Errorf("test %d, content length=%s, want %d", i, cl, len(body))
+		}
+	}
+}
+
+var decodeJSONTests = []struct {
+	header Header
+	body   string
+	ok     bool
+}{
+	{
+		// Content-Length truncates the JSON value.
+		header: NewHeader(HeaderContentType, "application/json", HeaderContentLength, "11"),
+		body:   `{"name":"gopher"}`,
+	},
+	{
+		header: NewHeader(HeaderContentType, "application/json; charset=utf-8"),
+		body:   `{"name":"gopher"}`,
+		ok:     true,
+	},
+	{
+		header: NewHeader(HeaderContentType, "application/vnd.api+json"),
+		body:   `{"name":"gopher"}`,
+		ok:     true,
+	},
+	{
+		header: NewHeader(HeaderContentType, "text/plain"),
+		body:   `{"name":"gopher"}`,
+	},
+	{
+		header: NewHeader(HeaderContentType, "application/json"),
+		body:   `{"name":`,
+	},
+	{
+		header: NewHeader(HeaderContentType, "application/json", HeaderContentLength, "100"),
+		body:   `{"name":"gopher"}`,
+	},
+	{
+		header: NewHeader(HeaderContentType, "application/json", HeaderContentLength, strconv.Itoa(MaxJSONBodyLen+1)),
+		body:   `{"name":"gopher"}`,
+	},
+}
+
+func TestDecodeJSON(t *testing.T) {
+	for i, tt := range decodeJSONTests {
+		var v struct {
+			Name string `json:"name"`
+		}
+		var err error
+		h := HandlerFunc(func(req *Request) {
+			err = req.DecodeJSON(&v)
+			req.Respond(StatusOK)
+		})
+		RunHandler("http://example.com/", "POST", tt.header, []byte(tt.body), h)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("test %d, unexpected error %v", i, err)
+			} else if v.Name != "gopher" {
+				t.Errorf("test %d, name=%q, want %q", i, v.Name, "gopher")
+			}
+		} else if err == nil {
+			t.Errorf("test %d, expected error", i)
+		}
+	}
+}
+
+type jsonHandlerItem struct {
+	Name string `json:"name"`
+}
+
+var jsonHandlerTests = []struct {
+	contentType string
+	body        string
+	status      int
+	result      string
+}{
+	{"application/json", `{"name":"gopher"}`, StatusOK, "gopher"},
+	{"text/plain", `{"name":"gopher"}`, StatusUnsupportedMediaType, ""},
+	{"application/json", `{"name":`, StatusBadRequest, ""},
+	{"application/json", `{"name":3}`, StatusBadRequest, ""},
+}
+
+func TestJSONHandler(t *testing.T) {
+	for _, prototype := range []interface{}{jsonHandlerItem{}, &jsonHandlerItem{}} {
+		var items []*jsonHandlerItem
+		h := JSONHandler(prototype, func(req *Request, v interface{}) {
+			items = append(items, v.(*jsonHandlerItem))
+			req.Respond(StatusOK)
+		})
+		for _, tt := range jsonHandlerTests {
+			status, _, _ := RunHandler("http://example.com/", "POST",
+				NewHeader(HeaderContentType, tt.contentType), []byte(tt.body), h)
+			if status != tt.status {
+				t.Errorf("%q %q, status=%d, want %d", tt.contentType, tt.body, status, tt.status)
+			}
+			if status == StatusOK && items[len(items)-1].Name != tt.result {
+				t.Errorf("%q %q, name=%q, want %q", tt.contentType, tt.body, items[len(items)-1].Name, tt.result)
+			}
+		}
+		// The handler allocates a new value for each request.
+		RunHandler("http://example.com/", "POST", NewHeader(HeaderContentType, "application/json"), []byte(`{}`), h)
+		if len(items) != 2 || items[0] == items[1] || items[1].Name != "" {
+			t.Errorf("values not allocated per request: %v", items)
+		}
+	}
+}
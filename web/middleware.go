@@ -15,8 +15,15 @@
 package web
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
+	"net"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
 )
 
 type filterResponder struct {
@@ -167,3 +174,402 @@ func (h formHandler) ServeWeb(req *Request) {
 
 	h.h.ServeWeb(req)
 }
+
+// BasicAuthHandler returns a handler that authenticates requests using HTTP
+// Basic authentication. The check function is called with the user name and
+// password from the Authorization header. If the header is missing or
+// malformed or check returns false, then the handler responds with status 401
+// and a challenge for the given realm. Otherwise, the user name is added to
+// the request Env with the key "twister.web.BasicAuthUser" and the request is
+// dispatched to h. The check function should use SecureCompare to compare
+// passwords.
+func BasicAuthHandler(realm string, check func(user, password string) bool, h Handler) Handler {
+	return basicAuthHandler{realm: realm, check: check, h: h}
+}
+
+type basicAuthHandler struct {
+	realm string
+	check func(user, password string) bool
+	h     Handler
+}
+
+// parseBasicAuth returns the user name and password from the value of an
+// Authorization header using the Basic scheme.
+func parseBasicAuth(s string) (user, password string, err error) {
+	const prefix = "basic "
+	if len(s) < len(prefix) || strings.ToLower(s[:len(prefix)]) != prefix {
+		return "", "", errors.New("twister: authorization scheme not basic")
+	}
+	p, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s[len(prefix):]))
+	if err != nil {
+		return "", "", err
+	}
+	s = string(p)
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return "", "", errors.New("twister: malformed basic credentials")
+	}
+	return s[:i], s[i+1:], nil
+}
+
+func (h basicAuthHandler) ServeWeb(req *Request) {
+	var err error
+	if s := req.Header.Get(HeaderAuthorization); s == "" {
+		err = errors.New("twister: authorization missing")
+	} else if user, password, e := parseBasicAuth(s); e != nil {
+		err = e
+	} else if !h.check(user, password) {
+		err = errors.New("twister: authorization failed for user " + user)
+	} else {
+		req.Env["twister.web.BasicAuthUser"] = user
+		h.h.ServeWeb(req)
+		return
+	}
+	req.Error(StatusUnauthorized, err,
+		HeaderWWWAuthenticate, "Basic realm="+QuoteHeaderValue(h.realm))
+}
+
+// MaxBodyHandler returns a handler that limits the length of the request body
+// to max bytes. Reads past the limit return ErrRequestEntityTooLarge. Handlers
+// should respond to the request with status 413 when they encounter this
+// error.
+func MaxBodyHandler(max int, h Handler) Handler {
+	return maxBodyHandler{max, h}
+}
+
+type maxBodyHandler struct {
+	max int
+	h   Handler
+}
+
+func (h maxBodyHandler) ServeWeb(req *Request) {
+	if req.Body != nil {
+		req.Body = &maxBodyReader{r: req.Body, n: h.max}
+	}
+	h.h.ServeWeb(req)
+}
+
+// maxBodyReader reads from r and returns ErrRequestEntityTooLarge if r has
+// more than n bytes.
+type maxBodyReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (r *maxBodyReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.n <= 0 {
+		// Check for EOF at the limit.
+		var b [1]byte
+		n, err := r.r.Read(b[:])
+		if n > 0 {
+			r.err = ErrRequestEntityTooLarge
+			return 0, r.err
+		}
+		if err != nil {
+			r.err = err
+		}
+		return 0, err
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// RequestIDHandler returns a handler that assigns an identifier to each
+// request. The identifier is taken from the X-Request-Id request header if
+// the header is present and valid. Otherwise, a random identifier is
+// generated. The identifier is added to the request Env with the key
+// "twister.web.RequestID" and is set in the X-Request-Id response header.
+func RequestIDHandler(h Handler) Handler {
+	return requestIDHandler{h}
+}
+
+type requestIDHandler struct {
+	h Handler
+}
+
+// validRequestID returns true if s is an acceptable request identifier from
+// a client.
+func validRequestID(s string) bool {
+	if len(s) == 0 || len(s) > 128 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func (h requestIDHandler) ServeWeb(req *Request) {
+	id := req.Header.Get(HeaderXRequestId)
+	if !validRequestID(id) {
+		var err error
+		id, err = randToken(16)
+		if err != nil {
+			req.Error(StatusInternalServerError, err)
+			return
+		}
+	}
+	req.Env["twister.web.RequestID"] = id
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		header.Set(HeaderXRequestId, id)
+		return status, header
+	})
+	h.h.ServeWeb(req)
+}
+
+// RecoverHandler returns a handler that recovers from panics in h. The panic
+// value and stack trace are written to logger. If logger is nil, then the
+// panic is written to os.Stderr. If h did not respond to the request before
+// the panic, then the handler responds with status 500.
+//
+// A panic with an HTTPError or *HTTPError value is a controlled failure. The
+// handler responds to the request with the error using FailWith and does not
+// log the panic.
+func RecoverHandler(h Handler, logger io.Writer) Handler {
+	if logger == nil {
+		logger = os.Stderr
+	}
+	return recoverHandler{h: h, logger: logger}
+}
+
+type recoverHandler struct {
+	h      Handler
+	logger io.Writer
+}
+
+func (h recoverHandler) ServeWeb(req *Request) {
+	responded := false
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		responded = true
+		return status, header
+	})
+	defer func() {
+		if r := recover(); r != nil {
+			var e *HTTPError
+			switch r := r.(type) {
+			case *HTTPError:
+				e = r
+			case HTTPError:
+				e = &r
+			default:
+				fmt.Fprintf(h.logger, "Panic while serving \"%s\": %v\n%s", req.URL, r, debug.Stack())
+			}
+			if responded {
+				return
+			}
+			if e != nil {
+				req.FailWith(e)
+			} else {
+				req.Error(StatusInternalServerError, fmt.Errorf("twister: panic %v", r))
+			}
+		}
+	}()
+	h.h.ServeWeb(req)
+}
+
+// AcceptEncodingHandler returns a handler that normalizes the Accept-Encoding
+// request header before dispatching the request to h. Whitespace is removed
+// from the header elements, the elements are lowercased and empty elements
+// are dropped. If the User-Agent request header contains any of the strings
+// in disableAgents, then the Accept-Encoding header is replaced with
+// "identity" to disable compression for clients that are known to mishandle
+// it.
+func AcceptEncodingHandler(disableAgents []string, h Handler) Handler {
+	return acceptEncodingHandler{disableAgents: disableAgents, h: h}
+}
+
+type acceptEncodingHandler struct {
+	disableAgents []string
+	h             Handler
+}
+
+// normalizeAcceptEncoding returns the normalized value of an Accept-Encoding
+// header.
+func normalizeAcceptEncoding(values []string) string {
+	var elements []string
+	for _, s := range NewHeader(HeaderAcceptEncoding, strings.Join(values, ",")).GetList(HeaderAcceptEncoding) {
+		s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+		if s != "" && s[0] != ';' {
+			elements = append(elements, s)
+		}
+	}
+	return strings.Join(elements, ", ")
+}
+
+func (h acceptEncodingHandler) ServeWeb(req *Request) {
+	if values, ok := req.Header[HeaderAcceptEncoding]; ok {
+		if s := normalizeAcceptEncoding(values); s != "" {
+			req.Header.Set(HeaderAcceptEncoding, s)
+		} else {
+			delete(req.Header, HeaderAcceptEncoding)
+		}
+	}
+	if ua := req.Header.Get(HeaderUserAgent); ua != "" {
+		for _, agent := range h.disableAgents {
+			if strings.Contains(ua, agent) {
+				req.Header.Set(HeaderAcceptEncoding, "identity")
+				break
+			}
+		}
+	}
+	h.h.ServeWeb(req)
+}
+
+// remoteIP returns the IP address part of a Request.RemoteAddr value.
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// ForwardedProtoHandler returns a handler that sets the request URL scheme
+// and Request.Secure from the X-Forwarded-Proto header when the request is
+// received from one of the trusted proxies. Trusted proxies are specified as
+// IP addresses or CIDR ranges.
+func ForwardedProtoHandler(trustedProxies []string, h Handler) Handler {
+	return forwardedProtoHandler{trustedProxies, h}
+}
+
+type forwardedProtoHandler struct {
+	trustedProxies []string
+	h              Handler
+}
+
+func (h forwardedProtoHandler) ServeWeb(req *Request) {
+	if isTrustedProxy(remoteIP(req.RemoteAddr), h.trustedProxies) {
+		switch strings.ToLower(req.Header.Get(HeaderXForwardedProto)) {
+		case "https":
+			req.URL.Scheme = "https"
+			req.Secure = true
+		case "http":
+			req.URL.Scheme = "http"
+			req.Secure = false
+		}
+	}
+	h.h.ServeWeb(req)
+}
+
+// Maintenance returns a filter that responds with status 503 and a
+// Retry-After header of retryAfter seconds when enabled returns true. Requests
+// from the IP addresses in allowIPs are dispatched to the next handler while
+// maintenance is enabled. When enabled returns false, all requests are
+// dispatched to the next handler.
+func Maintenance(enabled func() bool, allowIPs []string, retryAfter int) func(*Request, Handler) {
+	allow := make(map[string]bool)
+	for _, ip := range allowIPs {
+		allow[ip] = true
+	}
+	return func(req *Request, h Handler) {
+		if enabled() && !allow[remoteIP(req.RemoteAddr)] {
+			req.Error(StatusServiceUnavailable, errors.New("twister: down for maintenance"),
+				HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return
+		}
+		h.ServeWeb(req)
+	}
+}
+
+// BasePathHandler returns a handler for applications mounted under base by a
+// reverse proxy. The handler strips base from the request URL path before
+// dispatching the request to h. Paths that do not start with base are
+// dispatched to h unchanged so that the handler works with proxies that strip
+// the base path and proxies that do not.
+//
+// The base path is added to the request Env with the key
+// "twister.web.BasePath". Use Request.ExternalPath to generate links that
+// include the base path.
+func BasePathHandler(base string, h Handler) Handler {
+	return basePathHandler{strings.TrimRight(base, "/"), h}
+}
+
+type basePathHandler struct {
+	base string
+	h    Handler
+}
+
+func (h basePathHandler) ServeWeb(req *Request) {
+	if p := req.URL.Path; strings.HasPrefix(p, h.base) {
+		switch {
+		case len(p) == len(h.base):
+			req.URL.Path = "/"
+		case p[len(h.base)] == '/':
+			req.URL.Path = p[len(h.base):]
+		}
+	}
+	req.Env["twister.web.BasePath"] = h.base
+	h.h.ServeWeb(req)
+}
+
+// ExternalPath returns the path p with the base path set by BasePathHandler
+// prepended. Use this method to generate links to the application's
+// resources.
+func (req *Request) ExternalPath(p string) string {
+	base, _ := req.Env["twister.web.BasePath"].(string)
+	return base + p
+}
+
+// MethodOverrideHandler returns a handler that lets HTML forms tunnel PUT,
+// PATCH and DELETE requests through POST. For POST requests, the handler sets
+// the request method to the value of the X-HTTP-Method-Override header or the
+// "_method" request parameter. Override values other than PUT, PATCH and
+// DELETE are ignored. The "_method" parameter is only available from the
+// request body if the form is parsed before this handler is called.
+func MethodOverrideHandler(h Handler) Handler {
+	return methodOverrideHandler{h}
+}
+
+type methodOverrideHandler struct {
+	h Handler
+}
+
+func (h methodOverrideHandler) ServeWeb(req *Request) {
+	if req.Method == "POST" {
+		m := req.Header.Get(HeaderXHTTPMethodOverride)
+		if m == "" {
+			m = req.Param.Get("_method")
+		}
+		switch m = strings.ToUpper(m); m {
+		case "PUT", "PATCH", "DELETE":
+			req.Method = m
+		}
+	}
+	h.h.ServeWeb(req)
+}
+
+// AbsoluteRedirectHandler returns a handler that converts relative Location
+// response headers to absolute URLs using Request.AbsoluteURL. Use this
+// handler for clients that do not accept relative redirects.
+func AbsoluteRedirectHandler(h Handler) Handler {
+	return absoluteRedirectHandler{h}
+}
+
+type absoluteRedirectHandler struct {
+	h Handler
+}
+
+func (h absoluteRedirectHandler) ServeWeb(req *Request) {
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		if location := header.Get(HeaderLocation); location != "" {
+			header.Set(HeaderLocation, req.AbsoluteURL(location))
+		}
+		return status, header
+	})
+	h.h.ServeWeb(req)
+}
@@ -15,7 +15,10 @@
 package web
 
 import (
+	"bytes"
+	"encoding/base64"
 	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
@@ -109,3 +112,353 @@ func TestXSRF(t *testing.T) {
 		}
 	}
 }
+
+func TestXSRFSecureCookie(t *testing.T) {
+	h := FormHandler(1000, true, HandlerFunc(xsrfHandler))
+	for _, secure := range []bool{false, true} {
+		url := "http://example.com/"
+		if secure {
+			url = "https://example.com/"
+		}
+		_, header, _ := RunHandler(url, "GET", nil, nil, h)
+		if c := header.Get(HeaderSetCookie); strings.Contains(c, "; secure") != secure {
+			t.Errorf("%s, cookie=%q, want secure=%v", url, c, secure)
+		}
+	}
+}
+
+var basicAuthTests = []struct {
+	authorization string
+	status        int
+	user          string
+}{
+	{authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("gopher:secret")), status: StatusOK, user: "gopher"},
+	{authorization: "basic " + base64.StdEncoding.EncodeToString([]byte("gopher:secret")), status: StatusOK, user: "gopher"},
+	{authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("gopher:wrong")), status: StatusUnauthorized},
+	{authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("gopher")), status: StatusUnauthorized},
+	{authorization: "Basic !!!", status: StatusUnauthorized},
+	{authorization: "Bearer xyz", status: StatusUnauthorized},
+	{authorization: "", status: StatusUnauthorized},
+}
+
+func TestBasicAuthHandler(t *testing.T) {
+	check := func(user, password string) bool { return user == "gopher" && password == "secret" }
+	h := BasicAuthHandler("test realm", check, HandlerFunc(func(req *Request) {
+		user, _ := req.Env["twister.web.BasicAuthUser"].(string)
+		io.WriteString(req.Respond(StatusOK), user)
+	}))
+	for _, tt := range basicAuthTests {
+		var header Header
+		if tt.authorization != "" {
+			header = NewHeader(HeaderAuthorization, tt.authorization)
+		}
+		status, respHeader, body := RunHandler("http://example.com/", "GET", header, nil, h)
+		if status != tt.status {
+			t.Errorf("%q, status=%d, want %d", tt.authorization, status, tt.status)
+		}
+		if status == StatusOK {
+			if string(body) != tt.user {
+				t.Errorf("%q, user=%q, want %q", tt.authorization, body, tt.user)
+			}
+		} else if challenge := respHeader.Get(HeaderWWWAuthenticate); challenge != `Basic realm="test realm"` {
+			t.Errorf("%q, challenge=%q", tt.authorization, challenge)
+		}
+	}
+}
+
+var maxBodyTests = []struct {
+	header Header
+	body   string
+	err    error
+}{
+	// Chunked bodies.
+	{body: "hello", err: nil},
+	{body: "hello, world", err: ErrRequestEntityTooLarge},
+	{body: "1234567890", err: nil},
+	{body: "12345678901", err: ErrRequestEntityTooLarge},
+	// Body with content length.
+	{header: NewHeader(HeaderContentLength, "12"), body: "hello, world", err: ErrRequestEntityTooLarge},
+}
+
+func TestMaxBodyHandler(t *testing.T) {
+	for _, tt := range maxBodyTests {
+		var (
+			p   []byte
+			err error
+		)
+		h := MaxBodyHandler(10, HandlerFunc(func(req *Request) {
+			p, err = ioutil.ReadAll(req.Body)
+			if err == ErrRequestEntityTooLarge {
+				req.Error(StatusRequestEntityTooLarge, err)
+				return
+			}
+			req.Respond(StatusOK)
+		}))
+		status, _, _ := RunHandler("http://example.com/", "POST", tt.header, []byte(tt.body), h)
+		if err != tt.err {
+			t.Errorf("body %q, err=%v, want %v", tt.body, err, tt.err)
+		}
+		if tt.err == nil {
+			if string(p) != tt.body {
+				t.Errorf("body %q, read %q", tt.body, p)
+			}
+		} else {
+			if len(p) > 10 {
+				t.Errorf("body %q, read %d bytes past limit", tt.body, len(p))
+			}
+			if status != StatusRequestEntityTooLarge {
+				t.Errorf("body %q, status=%d, want %d", tt.body, status, StatusRequestEntityTooLarge)
+			}
+		}
+	}
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	h := RequestIDHandler(HandlerFunc(func(req *Request) {
+		io.WriteString(req.Respond(StatusOK), req.Env["twister.web.RequestID"].(string))
+	}))
+
+	// Generated identifiers.
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		_, header, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+		id := header.Get(HeaderXRequestId)
+		if !validRequestID(id) {
+			t.Errorf("generated id %q not valid", id)
+		}
+		if string(body) != id {
+			t.Errorf("env id=%q, header id=%q", body, id)
+		}
+		if seen[id] {
+			t.Errorf("duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+
+	// Supplied identifier.
+	_, header, body := RunHandler("http://example.com/", "GET", NewHeader(HeaderXRequestId, "abc-123"), nil, h)
+	if id := header.Get(HeaderXRequestId); id != "abc-123" || string(body) != "abc-123" {
+		t.Errorf("supplied id, header=%q body=%q, want %q", id, body, "abc-123")
+	}
+
+	// Invalid supplied identifier is replaced.
+	_, header, _ = RunHandler("http://example.com/", "GET", NewHeader(HeaderXRequestId, "bad id\x01"), nil, h)
+	if id := header.Get(HeaderXRequestId); id == "bad id\x01" || !validRequestID(id) {
+		t.Errorf("invalid supplied id not replaced, id=%q", id)
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	var log bytes.Buffer
+	h := RecoverHandler(HandlerFunc(func(req *Request) {
+		panic("before")
+	}), &log)
+	status, _, _ := RunHandler("http://example.com/a", "GET", nil, nil, h)
+	if status != StatusInternalServerError {
+		t.Errorf("before respond, status=%d, want %d", status, StatusInternalServerError)
+	}
+	if s := log.String(); !strings.Contains(s, "before") || !strings.Contains(s, "/a") {
+		t.Errorf("before respond, log=%q", s)
+	}
+
+	log.Reset()
+	h = RecoverHandler(HandlerFunc(func(req *Request) {
+		w := req.Respond(StatusOK, HeaderContentType, "text/plain")
+		io.WriteString(w, "hello")
+		panic("after")
+	}), &log)
+	status, _, body := RunHandler("http://example.com/b", "GET", nil, nil, h)
+	if status != StatusOK || string(body) != "hello" {
+		t.Errorf("after respond, status=%d body=%q, want %d %q", status, body, StatusOK, "hello")
+	}
+	if s := log.String(); !strings.Contains(s, "after") {
+		t.Errorf("after respond, log=%q", s)
+	}
+}
+
+func TestRecoverHandlerHTTPError(t *testing.T) {
+	var log bytes.Buffer
+	for _, tt := range []struct {
+		v    interface{}
+		body string
+	}{
+		{HTTPError{Status: StatusForbidden}, "Forbidden"},
+		{&HTTPError{Status: StatusForbidden, Message: "Go away."}, "Go away."},
+	} {
+		log.Reset()
+		v := tt.v
+		h := RecoverHandler(HandlerFunc(func(req *Request) {
+			panic(v)
+		}), &log)
+		status, _, body := RunHandler("http://example.com/a", "GET", nil, nil, h)
+		if status != StatusForbidden || string(body) != tt.body {
+			t.Errorf("panic(%#v), status=%d body=%q, want %d %q", v, status, body, StatusForbidden, tt.body)
+		}
+		if log.Len() != 0 {
+			t.Errorf("panic(%#v), log=%q, want empty", v, log.String())
+		}
+	}
+}
+
+var acceptEncodingTests = []struct {
+	header    Header
+	expected  string
+	hasHeader bool
+}{
+	{NewHeader(), "", false},
+	{NewHeader(HeaderAcceptEncoding, "gzip, deflate"), "gzip, deflate", true},
+	{NewHeader(HeaderAcceptEncoding, " GZip ;  q=0.5 ,,\tDeflate "), "gzip;q=0.5, deflate", true},
+	{NewHeader(HeaderAcceptEncoding, ", ,"), "", false},
+	{NewHeader(HeaderAcceptEncoding, "gzip", HeaderAcceptEncoding, "BR"), "gzip, br", true},
+	{NewHeader(HeaderAcceptEncoding, "gzip", HeaderUserAgent, "Mozilla/4.0 (compatible; MSIE 6.0)"), "identity", true},
+	{NewHeader(HeaderUserAgent, "Mozilla/4.0 (compatible; MSIE 6.0)"), "identity", true},
+	{NewHeader(HeaderAcceptEncoding, "gzip", HeaderUserAgent, "Mozilla/5.0"), "gzip", true},
+}
+
+func TestAcceptEncodingHandler(t *testing.T) {
+	for _, tt := range acceptEncodingTests {
+		var actual []string
+		h := AcceptEncodingHandler([]string{"MSIE 6"}, HandlerFunc(func(req *Request) {
+			actual = req.Header[HeaderAcceptEncoding]
+			req.Respond(StatusOK)
+		}))
+		RunHandler("http://example.com/", "GET", tt.header, nil, h)
+		if !tt.hasHeader {
+			if actual != nil {
+				t.Errorf("header %v, got %q, want no header", tt.header, actual)
+			}
+			continue
+		}
+		if len(actual) != 1 || actual[0] != tt.expected {
+			t.Errorf("header %v, got %q, want %q", tt.header, actual, tt.expected)
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	enabled := true
+	filter := Maintenance(func() bool { return enabled }, []string{"10.0.0.1"}, 120)
+	h := HandlerFunc(func(req *Request) { req.Respond(StatusOK) })
+
+	run := func(remoteAddr string) (int, Header) {
+		req, resp := NewTestRequest("GET", "http://example.com/", nil, nil)
+		req.RemoteAddr = remoteAddr
+		filter(req, h)
+		return resp.Status(), resp.Header()
+	}
+
+	status, header := run("1.2.3.4:5678")
+	if status != StatusServiceUnavailable {
+		t.Errorf("enabled, status=%d, want %d", status, StatusServiceUnavailable)
+	}
+	if s := header.Get(HeaderRetryAfter); s != "120" {
+		t.Errorf("enabled, Retry-After=%q, want %q", s, "120")
+	}
+
+	if status, _ := run("10.0.0.1:5678"); status != StatusOK {
+		t.Errorf("enabled and allowed, status=%d, want %d", status, StatusOK)
+	}
+
+	enabled = false
+	if status, _ := run("1.2.3.4:5678"); status != StatusOK {
+		t.Errorf("disabled, status=%d, want %d", status, StatusOK)
+	}
+}
+
+func TestBasePathHandler(t *testing.T) {
+	var path, link string
+	router := NewRouter().Register("/users/<id>", "GET", func(req *Request) {
+		path = req.URL.Path
+		link = req.ExternalPath("/users/" + req.URLParam["id"])
+		req.Respond(StatusOK)
+	})
+	h := BasePathHandler("/service1/", router)
+	for _, urlStr := range []string{"http://example.com/service1/users/7", "http://example.com/users/7"} {
+		path, link = "", ""
+		status, _, _ := RunHandler(urlStr, "GET", nil, nil, h)
+		if status != StatusOK {
+			t.Errorf("%s, status=%d, want %d", urlStr, status, StatusOK)
+		}
+		if path != "/users/7" {
+			t.Errorf("%s, path=%q, want /users/7", urlStr, path)
+		}
+		if link != "/service1/users/7" {
+			t.Errorf("%s, link=%q, want /service1/users/7", urlStr, link)
+		}
+	}
+	status, _, _ := RunHandler("http://example.com/service1x/users/7", "GET", nil, nil, h)
+	if status != StatusNotFound {
+		t.Errorf("service1x, status=%d, want %d", status, StatusNotFound)
+	}
+}
+
+var methodOverrideTests = []struct {
+	method string
+	header Header
+	body   string
+	want   string
+}{
+	{"POST", nil, "_method=put", "PUT"},
+	{"POST", nil, "_method=DELETE", "DELETE"},
+	{"POST", nil, "_method=CONNECT", "POST"},
+	{"POST", nil, "", "POST"},
+	{"GET", nil, "_method=delete", "GET"},
+	{"POST", NewHeader(HeaderXHTTPMethodOverride, "patch"), "", "PATCH"},
+	{"POST", NewHeader(HeaderXHTTPMethodOverride, "TRACE"), "", "POST"},
+	{"POST", NewHeader(HeaderXHTTPMethodOverride, "DELETE"), "_method=put", "DELETE"},
+}
+
+func TestMethodOverrideHandler(t *testing.T) {
+	for _, tt := range methodOverrideTests {
+		var method string
+		h := FormHandler(1000, false, MethodOverrideHandler(HandlerFunc(func(req *Request) {
+			method = req.Method
+			req.Respond(StatusOK)
+		})))
+		header := NewHeader(HeaderContentType, "application/x-www-form-urlencoded")
+		for k, v := range tt.header {
+			header[k] = v
+		}
+		RunHandler("http://example.com/", tt.method, header, []byte(tt.body), h)
+		if method != tt.want {
+			t.Errorf("%s %v %q, method=%s, want %s", tt.method, tt.header, tt.body, method, tt.want)
+		}
+	}
+}
+
+var forwardedProtoTests = []struct {
+	url     string
+	proto   string
+	trusted []string
+	scheme  string
+}{
+	{"http://example.com/", "", []string{"1.2.3.4"}, "http"},
+	{"http://example.com/", "https", []string{"1.2.3.4"}, "https"},
+	{"http://example.com/", "HTTPS", []string{"1.2.3.0/24"}, "https"},
+	{"http://example.com/", "https", []string{"5.6.7.8"}, "http"},
+	{"http://example.com/", "https", nil, "http"},
+	{"https://example.com/", "http", []string{"1.2.3.4"}, "http"},
+	{"https://example.com/", "", []string{"1.2.3.4"}, "https"},
+	{"http://example.com/", "gopher", []string{"1.2.3.4"}, "http"},
+}
+
+func TestForwardedProtoHandler(t *testing.T) {
+	for _, tt := range forwardedProtoTests {
+		var scheme string
+		var secure bool
+		h := ForwardedProtoHandler(tt.trusted, HandlerFunc(func(req *Request) {
+			scheme = req.URL.Scheme
+			secure = req.Secure
+			req.Respond(StatusOK)
+		}))
+		header := NewHeader()
+		if tt.proto != "" {
+			header.Set(HeaderXForwardedProto, tt.proto)
+		}
+		RunHandler(tt.url, "GET", header, nil, h)
+		if scheme != tt.scheme || secure != (tt.scheme == "https") {
+			t.Errorf("%s with proto %q and trusted %v: scheme=%s secure=%v, want scheme=%s",
+				tt.url, tt.proto, tt.trusted, scheme, secure, tt.scheme)
+		}
+	}
+}
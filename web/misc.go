@@ -20,6 +20,7 @@ import (
 	"crypto/rand"
 	"crypto/sha1"
 	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"io"
@@ -34,9 +35,18 @@ const ContentTypeHTML = "text/html; charset=\"utf-8\""
 // timeLayout is the time layout used for HTTP headers and other values.
 const timeLayout = "Mon, 02 Jan 2006 15:04:05 GMT"
 
+// nowFunc returns the current time. Code in this package that depends on the
+// current time calls nowFunc so that tests can control the clock.
+var nowFunc = time.Now
+
+// sleepFunc pauses the current goroutine. Code in this package that waits for
+// the clock returned by nowFunc to advance calls sleepFunc so that tests that
+// replace nowFunc can also replace sleepFunc.
+var sleepFunc = time.Sleep
+
 // formatExpiration returns current time plus delta formatted per HTTP conventions.
 func formatExpiration(delta time.Duration) string {
-	return time.Now().Add(delta).UTC().Format(timeLayout)
+	return nowFunc().Add(delta).UTC().Format(timeLayout)
 }
 
 var (
@@ -45,100 +55,123 @@ var (
 	dashDashCrlfBytes = []byte{'-', '-', '\r', '\n'}
 )
 
-// HTTP status codes from RFC 2606
+// HTTP status codes from RFC 2616 and later RFCs
 const (
-	StatusContinue                     = 100
-	StatusSwitchingProtocols           = 101
-	StatusOK                           = 200
-	StatusCreated                      = 201
-	StatusAccepted                     = 202
-	StatusNonAuthoritativeInformation  = 203
-	StatusNoContent                    = 204
-	StatusResetContent                 = 205
-	StatusPartialContent               = 206
-	StatusMultipleChoices              = 300
-	StatusMovedPermanently             = 301
-	StatusFound                        = 302
-	StatusSeeOther                     = 303
-	StatusNotModified                  = 304
-	StatusUseProxy                     = 305
-	StatusTemporaryRedirect            = 307
-	StatusBadRequest                   = 400
-	StatusUnauthorized                 = 401
-	StatusPaymentRequired              = 402
-	StatusForbidden                    = 403
-	StatusNotFound                     = 404
-	StatusMethodNotAllowed             = 405
-	StatusNotAcceptable                = 406
-	StatusProxyAuthenticationRequired  = 407
-	StatusRequestTimeout               = 408
-	StatusConflict                     = 409
-	StatusGone                         = 410
-	StatusLengthRequired               = 411
-	StatusPreconditionFailed           = 412
-	StatusRequestEntityTooLarge        = 413
-	StatusRequestURITooLong            = 414
-	StatusUnsupportedMediaType         = 415
-	StatusRequestedRangeNotSatisfiable = 416
-	StatusExpectationFailed            = 417
-	StatusInternalServerError          = 500
-	StatusNotImplemented               = 501
-	StatusBadGateway                   = 502
-	StatusServiceUnavailable           = 503
-	StatusGatewayTimeout               = 504
-	StatusHTTPVersionNotSupported      = 505
+	StatusContinue                      = 100
+	StatusSwitchingProtocols            = 101
+	StatusEarlyHints                    = 103
+	StatusOK                            = 200
+	StatusCreated                       = 201
+	StatusAccepted                      = 202
+	StatusNonAuthoritativeInformation   = 203
+	StatusNoContent                     = 204
+	StatusResetContent                  = 205
+	StatusPartialContent                = 206
+	StatusMultipleChoices               = 300
+	StatusMovedPermanently              = 301
+	StatusFound                         = 302
+	StatusSeeOther                      = 303
+	StatusNotModified                   = 304
+	StatusUseProxy                      = 305
+	StatusTemporaryRedirect             = 307
+	StatusPermanentRedirect             = 308
+	StatusBadRequest                    = 400
+	StatusUnauthorized                  = 401
+	StatusPaymentRequired               = 402
+	StatusForbidden                     = 403
+	StatusNotFound                      = 404
+	StatusMethodNotAllowed              = 405
+	StatusNotAcceptable                 = 406
+	StatusProxyAuthenticationRequired   = 407
+	StatusRequestTimeout                = 408
+	StatusConflict                      = 409
+	StatusGone                          = 410
+	StatusLengthRequired                = 411
+	StatusPreconditionFailed            = 412
+	StatusRequestEntityTooLarge         = 413
+	StatusRequestURITooLong             = 414
+	StatusUnsupportedMediaType          = 415
+	StatusRequestedRangeNotSatisfiable  = 416
+	StatusExpectationFailed             = 417
+	StatusMisdirectedRequest            = 421
+	StatusUnprocessableEntity           = 422
+	StatusLocked                        = 423
+	StatusFailedDependency              = 424
+	StatusUpgradeRequired               = 426
+	StatusPreconditionRequired          = 428
+	StatusTooManyRequests               = 429
+	StatusRequestHeaderFieldsTooLarge   = 431
+	StatusUnavailableForLegalReasons    = 451
+	StatusInternalServerError           = 500
+	StatusNotImplemented                = 501
+	StatusBadGateway                    = 502
+	StatusServiceUnavailable            = 503
+	StatusGatewayTimeout                = 504
+	StatusHTTPVersionNotSupported       = 505
+	StatusInsufficientStorage           = 507
+	StatusNetworkAuthenticationRequired = 511
 )
 
 var statusText = map[int]string{
-	StatusContinue:                     "Continue",
-	StatusSwitchingProtocols:           "Switching Protocols",
-	StatusOK:                           "OK",
-	StatusCreated:                      "Created",
-	StatusAccepted:                     "Accepted",
-	StatusNonAuthoritativeInformation:  "Non-Authoritative Information",
-	StatusNoContent:                    "No Content",
-	StatusResetContent:                 "Reset Content",
-	StatusPartialContent:               "Partial Content",
-	StatusMultipleChoices:              "Multiple Choices",
-	StatusMovedPermanently:             "Moved Permanently",
-	StatusFound:                        "Found",
-	StatusSeeOther:                     "See Other",
-	StatusNotModified:                  "Not Modified",
-	StatusUseProxy:                     "Use Proxy",
-	StatusTemporaryRedirect:            "Temporary Redirect",
-	StatusBadRequest:                   "Bad Request",
-	StatusUnauthorized:                 "Unauthorized",
-	StatusPaymentRequired:              "Payment Required",
-	StatusForbidden:                    "Forbidden",
-	StatusNotFound:                     "Not Found",
-	StatusMethodNotAllowed:             "Method Not Allowed",
-	StatusNotAcceptable:                "Not Acceptable",
-	StatusProxyAuthenticationRequired:  "Proxy Authentication Required",
-	StatusRequestTimeout:               "Request Timeout",
-	StatusConflict:                     "Conflict",
-	StatusGone:                         "Gone",
-	StatusLengthRequired:               "Length Required",
-	StatusPreconditionFailed:           "Precondition Failed",
-	StatusRequestEntityTooLarge:        "Request Entity Too Large",
-	StatusRequestURITooLong:            "Request URI Too Long",
-	StatusUnsupportedMediaType:         "Unsupported Media Type",
-	StatusRequestedRangeNotSatisfiable: "Requested Range Not Satisfiable",
-	StatusExpectationFailed:            "Expectation Failed",
-	StatusInternalServerError:          "Internal Server Error",
-	StatusNotImplemented:               "Not Implemented",
-	StatusBadGateway:                   "Bad Gateway",
-	StatusServiceUnavailable:           "Service Unavailable",
-	StatusGatewayTimeout:               "Gateway Timeout",
-	StatusHTTPVersionNotSupported:      "HTTP Version Not Supported",
+	StatusContinue:                      "Continue",
+	StatusSwitchingProtocols:            "Switching Protocols",
+	StatusEarlyHints:                    "Early Hints",
+	StatusOK:                            "OK",
+	StatusCreated:                       "Created",
+	StatusAccepted:                      "Accepted",
+	StatusNonAuthoritativeInformation:   "Non-Authoritative Information",
+	StatusNoContent:                     "No Content",
+	StatusResetContent:                  "Reset Content",
+	StatusPartialContent:                "Partial Content",
+	StatusMultipleChoices:               "Multiple Choices",
+	StatusMovedPermanently:              "Moved Permanently",
+	StatusFound:                         "Found",
+	StatusSeeOther:                      "See Other",
+	StatusNotModified:                   "Not Modified",
+	StatusUseProxy:                      "Use Proxy",
+	StatusTemporaryRedirect:             "Temporary Redirect",
+	StatusPermanentRedirect:             "Permanent Redirect",
+	StatusBadRequest:                    "Bad Request",
+	StatusUnauthorized:                  "Unauthorized",
+	StatusPaymentRequired:               "Payment Required",
+	StatusForbidden:                     "Forbidden",
+	StatusNotFound:                      "Not Found",
+	StatusMethodNotAllowed:              "Method Not Allowed",
+	StatusNotAcceptable:                 "Not Acceptable",
+	StatusProxyAuthenticationRequired:   "Proxy Authentication Required",
+	StatusRequestTimeout:                "Request Timeout",
+	StatusConflict:                      "Conflict",
+	StatusGone:                          "Gone",
+	StatusLengthRequired:                "Length Required",
+	StatusPreconditionFailed:            "Precondition Failed",
+	StatusRequestEntityTooLarge:         "Request Entity Too Large",
+	StatusRequestURITooLong:             "Request URI Too Long",
+	StatusUnsupportedMediaType:          "Unsupported Media Type",
+	StatusRequestedRangeNotSatisfiable:  "Requested Range Not Satisfiable",
+	StatusExpectationFailed:             "Expectation Failed",
+	StatusMisdirectedRequest:            "Misdirected Request",
+	StatusUnprocessableEntity:           "Unprocessable Entity",
+	StatusLocked:                        "Locked",
+	StatusFailedDependency:              "Failed Dependency",
+	StatusUpgradeRequired:               "Upgrade Required",
+	StatusPreconditionRequired:          "Precondition Required",
+	StatusTooManyRequests:               "Too Many Requests",
+	StatusRequestHeaderFieldsTooLarge:   "Request Header Fields Too Large",
+	StatusUnavailableForLegalReasons:    "Unavailable For Legal Reasons",
+	StatusInternalServerError:           "Internal Server Error",
+	StatusNotImplemented:                "Not Implemented",
+	StatusBadGateway:                    "Bad Gateway",
+	StatusServiceUnavailable:            "Service Unavailable",
+	StatusGatewayTimeout:                "Gateway Timeout",
+	StatusHTTPVersionNotSupported:       "HTTP Version Not Supported",
+	StatusInsufficientStorage:           "Insufficient Storage",
+	StatusNetworkAuthenticationRequired: "Network Authentication Required",
 }
 
-// StatusText returns a text description of an HTTP status code.
+// StatusText returns the standard reason phrase for an HTTP status code or ""
+// if the status code is not known.
 func StatusText(status int) string {
-	s, found := statusText[status]
-	if !found {
-		s = "Status " + strconv.Itoa(status)
-	}
-	return s
+	return statusText[status]
 }
 
 // ProtocolVersion combines HTTP major and minor protocol numbers into a single
@@ -153,6 +186,7 @@ func ProtocolVersion(major int, minor int) int {
 // Commonly used protocol versions in format returned by the ProtocolVersion
 // function.
 const (
+	ProtocolVersion09 = 9    // HTTP/0.9
 	ProtocolVersion10 = 1000 // HTTP/1.0
 	ProtocolVersion11 = 1001 // HTTP/1.1
 )
@@ -192,7 +226,7 @@ func signature(secret, key, expiration, value string) string {
 //      return web.VerifyValue(secret, "uid", req.Cookie.Get("uid"))
 //  }
 func SignValue(secret, context string, maxAge time.Duration, value string) string {
-	expiration := strconv.FormatInt(time.Now().Add(maxAge).Unix(), 16)
+	expiration := strconv.FormatInt(nowFunc().Add(maxAge).Unix(), 16)
 	sig := signature(secret, context, expiration, value)
 	return sig + "~" + expiration + "~" + value
 }
@@ -207,23 +241,30 @@ func VerifyValue(secret, context string, signedValue string) (string, error) {
 		return "", errVerificationFailure
 	}
 	expiration, err := strconv.ParseInt(a[1], 16, 64)
-	if err != nil || expiration < time.Now().Unix() {
+	if err != nil || expiration < nowFunc().Unix() {
 		return "", errVerificationFailure
 	}
 	expectedSig := signature(secret, context, a[1], a[2])
 	actualSig := a[0]
-	if len(actualSig) != len(expectedSig) {
+	if !SecureCompare([]byte(actualSig), []byte(expectedSig)) {
 		return "", errVerificationFailure
 	}
-	// Constant time compare
+	return a[2], nil
+}
+
+// SecureCompare returns true if a and b are equal. The time taken by the
+// comparison depends on the length of b and not on the contents of a or b.
+// Pass the expected secret as b and the value supplied by the client as a.
+func SecureCompare(a, b []byte) bool {
 	var v byte
-	for i := 0; i < len(actualSig); i++ {
-		v |= actualSig[i] ^ expectedSig[i]
-	}
-	if subtle.ConstantTimeByteEq(v, 0) != 1 {
-		return "", errVerificationFailure
+	for i := 0; i < len(b); i++ {
+		var c byte
+		if i < len(a) {
+			c = a[i]
+		}
+		v |= c ^ b[i]
 	}
-	return a[2], nil
+	return subtle.ConstantTimeByteEq(v, 0)&subtle.ConstantTimeEq(int32(len(a)), int32(len(b))) == 1
 }
 
 // HTMLEscapeString returns s with special HTML characters escaped. 
@@ -262,6 +303,29 @@ func HTMLEscapeString(s string) string {
 	return b.String()
 }
 
+// randReader is the source of random bytes for tokens and identifiers. Tests
+// replace the reader to generate predictable values.
+var randReader io.Reader = rand.Reader
+
+// randBytes returns n random bytes read from randReader.
+func randBytes(n int) ([]byte, error) {
+	p := make([]byte, n)
+	if _, err := io.ReadFull(randReader, p); err != nil {
+		return nil, errors.New("twister: could not read random bytes: " + err.Error())
+	}
+	return p, nil
+}
+
+// randToken returns a URL safe base64 encoding of n random bytes. The token
+// does not have padding characters.
+func randToken(n int) (string, error) {
+	p, err := randBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(p), nil
+}
+
 // CheckXSRF implements cross-site request forgery protection. Here's how it works:
 // 
 // CheckXSRF sets a cookie with name cookieName to a random token.
@@ -282,7 +346,7 @@ func HTMLEscapeString(s string) string {
 // set to the token. The application should use the value of the paramName
 // parameter when generating hidden fields in POSTed forms.
 //
-// CheckXSRF also validates PUT and DELETE requests. 
+// CheckXSRF also validates PUT, PATCH and DELETE requests. 
 //
 // The X-XSRFToken can be used to specify the token in addition to the
 // paramName request parameter.
@@ -296,13 +360,12 @@ func CheckXSRF(req *Request, cookieName string, paramName string) error {
 
 	// Create new XSRF token?
 	if len(expectedToken) != tokenLen {
-		p := make([]byte, tokenLen/2)
-		_, err := rand.Reader.Read(p)
+		var err error
+		expectedToken, err = randToken(tokenLen * 3 / 4)
 		if err != nil {
 			return err
 		}
-		expectedToken = hex.EncodeToString(p)
-		c := NewCookie(cookieName, expectedToken).String()
+		c := NewCookie(cookieName, expectedToken).Secure(req.Secure).String()
 		FilterRespond(req, func(status int, header Header) (int, Header) {
 			header.Add(HeaderSetCookie, c)
 			return status, header
@@ -314,10 +377,11 @@ func CheckXSRF(req *Request, cookieName string, paramName string) error {
 		actualToken = req.Header.Get(HeaderXXSRFToken)
 		req.Param.Set(paramName, expectedToken)
 	}
-	if expectedToken != actualToken {
+	if !SecureCompare([]byte(actualToken), []byte(expectedToken)) {
 		req.Param.Set(paramName, expectedToken)
 		if req.Method == "POST" ||
 			req.Method == "PUT" ||
+			req.Method == "PATCH" ||
 			req.Method == "DELETE" {
 			err := errors.New("twister: bad xsrf token")
 			if actualToken == "" {
@@ -15,7 +15,10 @@
 package web
 
 import (
+	"crypto/rand"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSignValue(t *testing.T) {
@@ -27,3 +30,108 @@ func TestSignValue(t *testing.T) {
 		t.Error("verify failed", err, actualValue)
 	}
 }
+
+func TestRandToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := randToken(16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) != 22 {
+			t.Errorf("len(%q) = %d, want 22", token, len(token))
+		}
+		if strings.IndexAny(token, "+/=") >= 0 {
+			t.Errorf("token %q is not URL safe", token)
+		}
+		if seen[token] {
+			t.Errorf("duplicate token %q", token)
+		}
+		seen[token] = true
+	}
+}
+
+var secureCompareTests = []struct {
+	a, b  string
+	equal bool
+}{
+	{"", "", true},
+	{"secret", "secret", true},
+	{"secreT", "secret", false},
+	{"terces", "secret", false},
+	{"secret", "secret1", false},
+	{"secret1", "secret", false},
+	{"", "secret", false},
+	{"secret", "", false},
+	{"secret\x00", "secret", false},
+}
+
+func TestSecureCompare(t *testing.T) {
+	for _, tt := range secureCompareTests {
+		if equal := SecureCompare([]byte(tt.a), []byte(tt.b)); equal != tt.equal {
+			t.Errorf("SecureCompare(%q, %q) = %v, want %v", tt.a, tt.b, equal, tt.equal)
+		}
+	}
+}
+
+func TestSignValueExpiration(t *testing.T) {
+	now := time.Unix(1300000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	signed := SignValue("secret", "context", 10*time.Minute, "value")
+	now = now.Add(9 * time.Minute)
+	if v, err := VerifyValue("secret", "context", signed); err != nil || v != "value" {
+		t.Errorf("before expiration, VerifyValue = %q, %v, want value", v, err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := VerifyValue("secret", "context", signed); err == nil {
+		t.Errorf("after expiration, VerifyValue returned nil error")
+	}
+}
+
+func TestRandReader(t *testing.T) {
+	if randReader != rand.Reader {
+		t.Fatal("randReader is not crypto/rand")
+	}
+	defer func() { randReader = rand.Reader }()
+
+	randReader = strings.NewReader("\x00\x01\x02\xfb\xfc\xfd")
+	if token, err := randToken(6); err != nil || token != "AAEC-_z9" {
+		t.Errorf("randToken(6) = %q, %v, want %q", token, err, "AAEC-_z9")
+	}
+	if _, err := randToken(6); err == nil {
+		t.Error("randToken with exhausted reader returned nil error")
+	}
+
+	randReader = strings.NewReader("\x00\x01\x02\xfb\xfc\xfd")
+	h := FormHandler(1000, true, HandlerFunc(xsrfHandler))
+	if _, _, body := RunHandler("http://example.com/", "GET", nil, nil, h); string(body) != "AAEC-_z9" {
+		t.Errorf("XSRF token=%q, want %q", body, "AAEC-_z9")
+	}
+}
+
+var statusTextTests = []struct {
+	status int
+	text   string
+}{
+	{StatusOK, "OK"},
+	{StatusNotFound, "Not Found"},
+	{StatusPermanentRedirect, "Permanent Redirect"},
+	{StatusUnprocessableEntity, "Unprocessable Entity"},
+	{StatusPreconditionRequired, "Precondition Required"},
+	{StatusTooManyRequests, "Too Many Requests"},
+	{StatusRequestHeaderFieldsTooLarge, "Request Header Fields Too Large"},
+	{StatusUnavailableForLegalReasons, "Unavailable For Legal Reasons"},
+	{StatusNetworkAuthenticationRequired, "Network Authentication Required"},
+	{299, ""},
+	{599, ""},
+}
+
+func TestStatusText(t *testing.T) {
+	for _, tt := range statusTextTests {
+		if text := StatusText(tt.status); text != tt.text {
+			t.Errorf("StatusText(%d) = %q, want %q", tt.status, text, tt.text)
+		}
+	}
+}
@@ -21,6 +21,9 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 var scratch [1024]byte
@@ -46,7 +49,44 @@ type Part struct {
 	Filename     string
 	ContentType  string
 	ContentParam map[string]string
-	Data         []byte
+
+	// The part's data for parts returned by ParseMultipartForm.
+	Data []byte
+
+	// The part's header and data for parts returned by NextPart. The reader
+	// is valid until the next call to NextPart.
+	Header Header
+	Reader io.Reader
+}
+
+// Save writes the part's data to a new file named name in directory dir. For
+// parts returned by NextPart, Save copies the data from the part's reader. The
+// file is created with permissions 0600. Save returns an error if the file
+// already exists or if name is not a plain file name, for example because it
+// contains a path separator or is "..". Do not use the client supplied
+// Filename as the name without sanitizing it first.
+func (p *Part) Save(dir, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) ||
+		filepath.Base(name) != name {
+		return errors.New("twister: invalid file name " + name)
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if p.Reader != nil {
+		_, err = io.Copy(f, p.Reader)
+	} else {
+		_, err = f.Write(p.Data)
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
 }
 
 // ParseMultipartForm parses a multipart/form-data body. Form fields are added
@@ -95,6 +135,41 @@ func ParseMultipartForm(req *Request, maxRequestBodyLen int) ([]Part, error) {
 	return parts, nil
 }
 
+const multipartReaderEnvKey = "twister.web.MultipartReader"
+
+// NextPart returns the next part of a multipart/form-data request body. The
+// part's data is read incrementally from Part.Reader so that large uploads
+// can be streamed to their destination without buffering the body in memory.
+// Calling NextPart again skips any unread data in the current part. NextPart
+// returns io.EOF if no more parts remain. The request body is limited to
+// maxRequestBodyLen bytes. The limit from the first call to NextPart applies
+// to the entire body.
+func (req *Request) NextPart(maxRequestBodyLen int) (*Part, error) {
+	m, _ := req.Env[multipartReaderEnvKey].(*MultipartReader)
+	if m == nil {
+		var err error
+		m, err = NewMultipartReader(req, maxRequestBodyLen)
+		if err != nil {
+			return nil, err
+		}
+		req.Env[multipartReaderEnvKey] = m
+	}
+	header, r, err := m.Next()
+	if err != nil {
+		return nil, err
+	}
+	_, dispParam := header.GetValueParam(HeaderContentDisposition)
+	contentType, contentParam := header.GetValueParam(HeaderContentType)
+	return &Part{
+		Name:         dispParam["name"],
+		Filename:     dispParam["filename"],
+		ContentType:  contentType,
+		ContentParam: contentParam,
+		Header:       header,
+		Reader:       r,
+	}, nil
+}
+
 // MultipartReader reads a multipart/form-data request body.
 type MultipartReader struct {
 	br       *bufio.Reader
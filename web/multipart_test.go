@@ -15,7 +15,11 @@
 package web
 
 import (
+	"io"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -156,3 +160,110 @@ func TestMultiPart(t *testing.T) {
 		}
 	}
 }
+
+func TestPartSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twister")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := &Part{Name: "upload", Filename: "hello.txt", Data: []byte("Hello, World!")}
+	path := filepath.Join(dir, "hello.txt")
+	if err := p.Save(dir, "hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Hello, World!" {
+		t.Errorf("data=%q", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("stat=%v, %v, want mode 0600", info, err)
+	}
+	if err := p.Save(dir, "hello.txt"); err == nil {
+		t.Errorf("Save overwrote existing file")
+	}
+	for _, name := range []string{"..", "../escape.txt", "sub/escape.txt", "/etc/escape.txt", ""} {
+		if err := p.Save(dir, name); err == nil {
+			t.Errorf("Save allowed name %q", name)
+		}
+	}
+}
+
+func TestNextPart(t *testing.T) {
+	body := "--deadbeef\r\n" +
+		"Content-Disposition: form-data; name=a; filename=\"a.txt\"\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		strings.Repeat("abcd", 1025) +
+		"\r\n--deadbeef\r\n" +
+		"Content-Disposition: form-data; name=b; filename=\"b.bin\"\r\n" +
+		"\r\n" +
+		"saved" +
+		"\r\n--deadbeef\r\n" +
+		"Content-Disposition: form-data; name=c; filename=\"c.bin\"\r\n" +
+		"\r\n" +
+		"skipped" +
+		"\r\n--deadbeef\r\n" +
+		"Content-Disposition: form-data; name=d; filename=\"d.txt\"\r\n" +
+		"\r\n" +
+		"world" +
+		"\r\n--deadbeef--\r\n"
+	req, _ := NewTestRequest("POST", "http://example.com/", NewHeader(HeaderContentType, "multipart/form-data; boundary=deadbeef"), []byte(body))
+
+	p, err := req.NextPart(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "a" || p.Filename != "a.txt" || p.ContentType != "text/plain" || p.Header.Get(HeaderContentType) != "text/plain" {
+		t.Errorf("first part=%+v", p)
+	}
+	data, err := ioutil.ReadAll(p.Reader)
+	if err != nil || string(data) != strings.Repeat("abcd", 1025) {
+		t.Errorf("first part data length=%d, err=%v", len(data), err)
+	}
+
+	dir, err := ioutil.TempDir("", "twister")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if p, err = req.NextPart(1 << 20); err != nil || p.Name != "b" {
+		t.Fatalf("second part=%+v, err=%v", p, err)
+	}
+	if err := p.Save(dir, "b.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "b.bin")); err != nil || string(data) != "saved" {
+		t.Errorf("saved part data=%q, err=%v", data, err)
+	}
+
+	// Advance past the third part without reading it.
+	if p, err = req.NextPart(1 << 20); err != nil || p.Name != "c" {
+		t.Fatalf("third part=%+v, err=%v", p, err)
+	}
+
+	p, err = req.NextPart(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "d" || p.Filename != "d.txt" {
+		t.Errorf("fourth part=%+v", p)
+	}
+	if data, err := ioutil.ReadAll(p.Reader); err != nil || string(data) != "world" {
+		t.Errorf("fourth part data=%q, err=%v", data, err)
+	}
+
+	if _, err := req.NextPart(1 << 20); err != io.EOF {
+		t.Errorf("NextPart at end, err=%v, want io.EOF", err)
+	}
+
+	req, _ = NewTestRequest("POST", "http://example.com/", NewHeader(HeaderContentType, "multipart/form-data; boundary=deadbeef"), []byte(body))
+	req.ContentLength = len(body)
+	if _, err := req.NextPart(len(body) - 1); err != ErrRequestEntityTooLarge {
+		t.Errorf("NextPart over limit, err=%v, want %v", err, ErrRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"strconv"
+	"strings"
+)
+
+// quality returns the value of the q parameter in an Accept-* header element.
+func quality(vp ValueParams) float64 {
+	s, ok := vp.Param["q"]
+	if !ok {
+		return 1
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return q
+}
+
+// matchMediaRange returns the specificity of the match between the media
+// range r from an Accept header and the media type t, or -1 if the range
+// does not match the type.
+func matchMediaRange(r, t string) int {
+	switch {
+	case r == t:
+		return 2
+	case r == "*/*":
+		return 0
+	case strings.HasSuffix(r, "/*") && strings.HasPrefix(t, r[:len(r)-1]):
+		return 1
+	}
+	return -1
+}
+
+// negotiate returns the offer with the highest quality in the parsed Accept-*
+// header accept. The quality of an offer is taken from the most specific
+// element of the header that matches the offer. Ties are broken by the order
+// of the offers. If accept is empty, then the first offer is returned.
+func negotiate(accept []ValueParams, offers []string, match func(r, offer string) int) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if len(accept) == 0 {
+		return offers[0]
+	}
+	best := ""
+	bestQ := float64(0)
+	for _, offer := range offers {
+		o := strings.ToLower(offer)
+		specificity := -1
+		q := float64(0)
+		for _, vp := range accept {
+			if s := match(vp.Value, o); s > specificity {
+				specificity = s
+				q = quality(vp)
+			}
+		}
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+	return best
+}
+
+// Accepts returns the offered media type best matching the request's Accept
+// header or "" if none of the offers are acceptable. The Accept header may
+// contain media ranges such as "text/*" and "*/*" and quality values. If the
+// request does not have an Accept header, then the first offer is returned.
+//
+//  switch req.Accepts("application/json", "text/html") {
+//  case "application/json":
+//      req.RespondJSON(web.StatusOK, data)
+//  case "text/html":
+//      req.RenderTemplate(web.StatusOK, t, data)
+//  default:
+//      req.Error(web.StatusNotAcceptable, nil)
+//  }
+func (req *Request) Accepts(offers ...string) string {
+	return negotiate(req.Header.GetAccept(HeaderAccept), offers, matchMediaRange)
+}
+
+// matchLanguageRange returns the specificity of the match between the
+// language range r from an Accept-Language header and the language tag t, or
+// -1 if the range does not match the tag. A range matches tags that it is a
+// prefix of, as in "en" and "en-us". A tag also matches ranges that it is a
+// prefix of so that supported language "en" matches an "en-us" range.
+func matchLanguageRange(r, t string) int {
+	switch {
+	case r == t:
+		return len(r) + 1
+	case r == "*":
+		return 0
+	case strings.HasPrefix(t, r+"-"):
+		return len(r)
+	case strings.HasPrefix(r, t+"-"):
+		return len(t)
+	}
+	return -1
+}
+
+// AcceptsLanguage returns the supported language tag best matching the
+// request's Accept-Language header or "" if none of the supported languages
+// are acceptable. If the request does not have an Accept-Language header,
+// then the first supported language is returned.
+func (req *Request) AcceptsLanguage(supported ...string) string {
+	return negotiate(req.Header.GetAccept(HeaderAcceptLanguage), supported, matchLanguageRange)
+}
+
+// matchCharset returns the specificity of the match between the charset
+// range r from an Accept-Charset header and the charset c, or -1 if the range
+// does not match the charset.
+func matchCharset(r, c string) int {
+	switch {
+	case r == c:
+		return 1
+	case r == "*":
+		return 0
+	}
+	return -1
+}
+
+// AcceptsCharset returns the offered charset best matching the request's
+// Accept-Charset header or "" if none of the offers are acceptable. If the
+// request does not have an Accept-Charset header, then the first offer is
+// returned.
+func (req *Request) AcceptsCharset(offers ...string) string {
+	return negotiate(req.Header.GetAccept(HeaderAcceptCharset), offers, matchCharset)
+}
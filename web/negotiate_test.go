@@ -0,0 +1,106 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"testing"
+)
+
+var acceptsTests = []struct {
+	accept   string
+	offers   []string
+	expected string
+}{
+	{"", []string{"application/json", "text/html"}, "application/json"},
+	{"*/*", []string{"application/json", "text/html"}, "application/json"},
+	{"text/html", []string{"application/json", "text/html"}, "text/html"},
+	{"text/*", []string{"application/json", "text/plain"}, "text/plain"},
+	{"image/png", []string{"application/json", "text/html"}, ""},
+	{"Text/HTML", []string{"application/json", "text/html"}, "text/html"},
+	{"application/json; q=0.5, text/html", []string{"application/json", "text/html"}, "text/html"},
+	{"application/json; q=0.9, text/html; q=0.8, */*; q=0.1", []string{"text/html", "application/json", "image/png"}, "application/json"},
+	{"text/*; q=0.5, text/html; q=0, */*; q=0.1", []string{"text/html", "text/plain"}, "text/plain"},
+	{"text/*; q=0.5, text/html; q=0, */*; q=0.1", []string{"text/html", "image/png"}, "image/png"},
+	{"text/html; q=0", []string{"text/html"}, ""},
+	{"text/html;level=1, text/html; q=0.7, */*; q=0.5", []string{"text/plain", "text/html"}, "text/html"},
+}
+
+func TestAccepts(t *testing.T) {
+	for _, tt := range acceptsTests {
+		req := &Request{Header: NewHeader()}
+		if tt.accept != "" {
+			req.Header.Set(HeaderAccept, tt.accept)
+		}
+		if actual := req.Accepts(tt.offers...); actual != tt.expected {
+			t.Errorf("Accept: %q, Accepts(%q) = %q, want %q", tt.accept, tt.offers, actual, tt.expected)
+		}
+	}
+}
+
+var acceptsLanguageTests = []struct {
+	accept    string
+	supported []string
+	expected  string
+}{
+	{"", []string{"en", "fr"}, "en"},
+	{"fr", []string{"en", "fr"}, "fr"},
+	{"*", []string{"en", "fr"}, "en"},
+	{"de", []string{"en", "fr"}, ""},
+	{"en-US", []string{"fr", "en"}, "en"},
+	{"en", []string{"fr", "en-GB"}, "en-GB"},
+	{"EN-gb", []string{"en-US", "en-GB"}, "en-GB"},
+	{"da, en-gb;q=0.8, en;q=0.7", []string{"en", "en-GB", "da"}, "da"},
+	{"da;q=0.5, en-gb;q=0.8, en;q=0.7", []string{"en-US", "da"}, "en-US"},
+	{"fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5", []string{"de", "en"}, "en"},
+	{"fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5", []string{"de"}, "de"},
+	{"en;q=0", []string{"en-US"}, ""},
+}
+
+func TestAcceptsLanguage(t *testing.T) {
+	for _, tt := range acceptsLanguageTests {
+		req := &Request{Header: NewHeader()}
+		if tt.accept != "" {
+			req.Header.Set(HeaderAcceptLanguage, tt.accept)
+		}
+		if actual := req.AcceptsLanguage(tt.supported...); actual != tt.expected {
+			t.Errorf("Accept-Language: %q, AcceptsLanguage(%q) = %q, want %q", tt.accept, tt.supported, actual, tt.expected)
+		}
+	}
+}
+
+var acceptsCharsetTests = []struct {
+	accept string
+	offers []string
+	result string
+}{
+	{"", []string{"utf-8", "iso-8859-1"}, "utf-8"},
+	{"iso-8859-1", []string{"utf-8", "iso-8859-1"}, "iso-8859-1"},
+	{"utf-8;q=0.5, iso-8859-1", []string{"utf-8", "iso-8859-1"}, "iso-8859-1"},
+	{"*", []string{"utf-8", "iso-8859-1"}, "utf-8"},
+	{"iso-8859-1;q=0.5, *", []string{"iso-8859-1", "utf-8"}, "utf-8"},
+	{"utf-16", []string{"utf-8", "iso-8859-1"}, ""},
+}
+
+func TestAcceptsCharset(t *testing.T) {
+	for _, tt := range acceptsCharsetTests {
+		req := &Request{Header: NewHeader()}
+		if tt.accept != "" {
+			req.Header.Set(HeaderAcceptCharset, tt.accept)
+		}
+		if result := req.AcceptsCharset(tt.offers...); result != tt.result {
+			t.Errorf("AcceptsCharset(%v) with %q = %q, want %q", tt.offers, tt.accept, result, tt.result)
+		}
+	}
+}
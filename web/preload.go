@@ -0,0 +1,63 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+const preloadEnvKey = "twister.web.Preload"
+
+// Preload adds a preload hint for the resource at urlStr to the response. The
+// asType argument specifies the kind of resource, for example "script",
+// "style" or "image". The hints are sent to the client as Link headers when
+// the application responds to the request. Call SendEarlyHints to also send
+// the hints before the final response.
+func (req *Request) Preload(urlStr, asType string) {
+	link := "<" + urlStr + ">; rel=preload"
+	if asType != "" {
+		link += "; as=" + asType
+	}
+	links, ok := req.Env[preloadEnvKey].([]string)
+	if !ok {
+		FilterRespond(req, func(status int, header Header) (int, Header) {
+			for _, link := range PreloadLinks(req) {
+				header.Add(HeaderLink, link)
+			}
+			return status, header
+		})
+	}
+	req.Env[preloadEnvKey] = append(links, link)
+}
+
+// PreloadLinks returns the Link header values for the preload hints added to
+// the request with Preload.
+func PreloadLinks(req *Request) []string {
+	links, _ := req.Env[preloadEnvKey].([]string)
+	return links
+}
+
+// SendEarlyHints sends the preload hints added to the request with Preload to
+// the client in a 103 Early Hints interim response. The client can fetch the
+// resources while the application prepares the final response, which also
+// includes the hints. SendEarlyHints does nothing if there are no hints, the
+// client does not support HTTP/1.1 or the request body does not implement
+// EarlyHintsSender.
+func (req *Request) SendEarlyHints() error {
+	links := PreloadLinks(req)
+	if len(links) == 0 {
+		return nil
+	}
+	if s, ok := req.Body.(EarlyHintsSender); ok {
+		return s.SendEarlyHints(Header{HeaderLink: links})
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreload(t *testing.T) {
+	h := HandlerFunc(func(req *Request) {
+		req.Preload("/static/app.js", "script")
+		req.Preload("/static/app.css", "style")
+		req.Respond(StatusOK)
+	})
+	_, header, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+	expected := []string{
+		"</static/app.js>; rel=preload; as=script",
+		"</static/app.css>; rel=preload; as=style",
+	}
+	if links := header[HeaderLink]; !reflect.DeepEqual(links, expected) {
+		t.Errorf("links=%q, want %q", links, expected)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errBadRange           = errors.New("twister: bad range")
+	errUnsatisfiableRange = errors.New("twister: range not satisfiable")
+)
+
+// byteRange specifies a range of bytes in an entity.
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" +
+		strconv.FormatInt(r.start+r.length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
+
+// parseRange parses a Range header value for an entity with the given size.
+// Ranges that start past the end of the entity are dropped. The error
+// errBadRange is returned if the header is malformed and the error
+// errUnsatisfiableRange is returned if no range is satisfiable.
+func parseRange(s string, size int64) ([]byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, errBadRange
+	}
+	var ranges []byteRange
+	for _, spec := range strings.Split(s[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.IndexByte(spec, '-')
+		if i < 0 {
+			return nil, errBadRange
+		}
+		first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		var r byteRange
+		if first == "" {
+			// Suffix range: the last n bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errBadRange
+			}
+			if n == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.start = size - n
+			r.length = n
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errBadRange
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, errBadRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r.start = start
+			r.length = end - start + 1
+		}
+		if r.length > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// checkIfRange returns true if the request Range header should be honored
+// given the current entity tag (without quotes) and modification time of the
+// entity. The Range header is honored if the request does not have an
+// If-Range header or if the If-Range header matches the entity.
+func checkIfRange(req *Request, etag string, modtime time.Time) bool {
+	s := req.Header.Get(HeaderIfRange)
+	if s == "" {
+		return true
+	}
+	if strings.HasPrefix(s, "\"") {
+		// Strong comparison of entity tags.
+		return etag != "" && UnquoteHeaderValue(s) == etag
+	}
+	if strings.HasPrefix(s, "W/") {
+		return false
+	}
+	t, err := time.Parse(timeLayout, s)
+	if err != nil || modtime.IsZero() {
+		return false
+	}
+	return t.Unix() == modtime.Unix()
+}
+
+// maxRanges is the maximum number of ranges served in a multipart/byteranges
+// response. Requests with more ranges get the full entity.
+const maxRanges = 16
+
+// serveContent responds to the request with status, header and the size bytes
+// of content in rs. If status is 200, then serveContent handles range
+// requests using the entity tag (without quotes) and modification time to
+// evaluate the If-Range header.
+func serveContent(req *Request, status int, header Header, rs io.ReadSeeker, size int64, etag string, modtime time.Time) {
+	var (
+		ranges []byteRange
+		parts  [][]byte // headers for multipart parts
+		final  []byte   // final boundary for multipart
+	)
+	if status == StatusOK && (req.Method == "GET" || req.Method == "HEAD") {
+		header.Set(HeaderAcceptRanges, "bytes")
+		if s := req.Header.Get(HeaderRange); s != "" && checkIfRange(req, etag, modtime) {
+			var err error
+			ranges, err = parseRange(s, size)
+			if err == errBadRange {
+				req.Error(StatusRequestedRangeNotSatisfiable, nil,
+					HeaderContentRange, "bytes */"+strconv.FormatInt(size, 10))
+				return
+			}
+			// Unsatisfiable ranges get the full entity.
+			if len(ranges) > maxRanges {
+				ranges = nil
+			}
+		}
+	}
+
+	switch {
+	case len(ranges) == 1:
+		status = StatusPartialContent
+		header.Set(HeaderContentRange, ranges[0].contentRange(size))
+		header.Set(HeaderContentLength, strconv.FormatInt(ranges[0].length, 10))
+	case len(ranges) > 1:
+		boundary, err := randToken(16)
+		if err != nil {
+			req.Error(StatusInternalServerError, err)
+			return
+		}
+		contentType := header.Get(HeaderContentType)
+		var length int64
+		for i, r := range ranges {
+			var b bytes.Buffer
+			if i > 0 {
+				b.WriteString("\r\n")
+			}
+			b.WriteString("--")
+			b.WriteString(boundary)
+			b.WriteString("\r\n")
+			if contentType != "" {
+				b.WriteString(HeaderContentType + ": " + contentType + "\r\n")
+			}
+			b.WriteString(HeaderContentRange + ": " + r.contentRange(size) + "\r\n\r\n")
+			parts = append(parts, b.Bytes())
+			length += int64(b.Len()) + r.length
+		}
+		final = []byte("\r\n--" + boundary + "--\r\n")
+		length += int64(len(final))
+		status = StatusPartialContent
+		header.Set(HeaderContentType, "multipart/byteranges; boundary="+boundary)
+		header.Set(HeaderContentLength, strconv.FormatInt(length, 10))
+	}
+
+	w := req.Responder.Respond(status, header)
+	if req.Method == "HEAD" || status == StatusNotModified {
+		return
+	}
+
+	switch {
+	case len(ranges) == 0:
+		copyResponse(w, io.LimitReader(rs, size))
+	case len(ranges) == 1:
+		if _, err := rs.Seek(ranges[0].start, 0); err != nil {
+			return
+		}
+		copyResponse(w, io.LimitReader(rs, ranges[0].length))
+	default:
+		for i, r := range ranges {
+			if _, err := w.Write(parts[i]); err != nil {
+				return
+			}
+			if _, err := rs.Seek(r.start, 0); err != nil {
+				return
+			}
+			if _, err := copyResponse(w, io.LimitReader(rs, r.length)); err != nil {
+				return
+			}
+		}
+		w.Write(final)
+	}
+}
+
+// ServeContent responds to the request with the size bytes of content in rs.
+// ServeContent handles range requests and sets the Accept-Ranges,
+// Content-Length and Content-Range headers. The modification time modtime is
+// in seconds since the Unix epoch. If modtime is not zero, then ServeContent
+// sets the Last-Modified header and uses modtime to evaluate the If-Range
+// request header. If the request Range header is malformed, then ServeContent
+// responds with status 416. If the request does not have a Range header or
+// no range is satisfiable, then ServeContent responds with the full content.
+//
+// The application should set other headers such as Content-Type in
+// headerKeysAndValues.
+func (req *Request) ServeContent(modtime int64, size int, rs io.ReadSeeker, headerKeysAndValues ...string) {
+	header := NewHeader(headerKeysAndValues...)
+	var t time.Time
+	if modtime != 0 {
+		t = time.Unix(modtime, 0)
+		header.Set(HeaderLastModified, t.UTC().Format(timeLayout))
+	}
+	header.Set(HeaderContentLength, strconv.Itoa(size))
+	serveContent(req, StatusOK, header, rs, int64(size), "", t)
+}
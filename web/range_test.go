@@ -0,0 +1,176 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var parseRangeTests = []struct {
+	s      string
+	ranges []byteRange
+}{
+	{"", nil},
+	{"bytes=", nil},
+	{"items=0-9", nil},
+	{"bytes=0-9", []byteRange{{0, 10}}},
+	{"bytes=5-", []byteRange{{5, 95}}},
+	{"bytes=-10", []byteRange{{90, 10}}},
+	{"bytes=-1000", []byteRange{{0, 100}}},
+	{"bytes=90-200", []byteRange{{90, 10}}},
+	{"bytes=100-200", nil},
+	{"bytes=9-0", nil},
+	{"bytes=a-b", nil},
+	{"bytes=0-9, 20-29", []byteRange{{0, 10}, {20, 10}}},
+	{"bytes=0-9,200-300", []byteRange{{0, 10}}},
+}
+
+func TestParseRange(t *testing.T) {
+	for _, tt := range parseRangeTests {
+		ranges, err := parseRange(tt.s, 100)
+		if (err != nil) != (tt.ranges == nil) {
+			t.Errorf("parseRange(%q) err=%v", tt.s, err)
+		}
+		if !reflect.DeepEqual(ranges, tt.ranges) {
+			t.Errorf("parseRange(%q)=%v, want %v", tt.s, ranges, tt.ranges)
+		}
+	}
+}
+
+func TestServeContentMultipleRanges(t *testing.T) {
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	h := HandlerFunc(func(req *Request) {
+		serveContent(req, StatusOK, NewHeader(HeaderContentType, "text/plain"),
+			strings.NewReader(content), int64(len(content)), "", time.Time{})
+	})
+	status, header, body := RunHandler("http://example.com/", "GET",
+		NewHeader(HeaderRange, "bytes=0-3,-5"), nil, h)
+	if status != StatusPartialContent {
+		t.Fatalf("status=%d, want %d", status, StatusPartialContent)
+	}
+	if cl := header.Get(HeaderContentLength); cl != strconv.Itoa(len(body)) {
+		t.Errorf("Content-Length=%s, body length=%d", cl, len(body))
+	}
+	mediaType, param := header.GetValueParam(HeaderContentType)
+	if mediaType != "multipart/byteranges" {
+		t.Fatalf("content type=%q, want multipart/byteranges", mediaType)
+	}
+
+	expected := []struct{ contentRange, data string }{
+		{"bytes 0-3/36", "0123"},
+		{"bytes 31-35/36", "vwxyz"},
+	}
+	mr := multipart.NewReader(bytes.NewReader(body), param["boundary"])
+	for i, e := range expected {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("part %d, %v", i, err)
+		}
+		if cr := part.Header.Get(HeaderContentRange); cr != e.contentRange {
+			t.Errorf("part %d, Content-Range=%q, want %q", i, cr, e.contentRange)
+		}
+		if ct := part.Header.Get(HeaderContentType); ct != "text/plain" {
+			t.Errorf("part %d, Content-Type=%q, want text/plain", i, ct)
+		}
+		data, _ := ioutil.ReadAll(part)
+		if string(data) != e.data {
+			t.Errorf("part %d, data=%q, want %q", i, data, e.data)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected end of parts, got %v", err)
+	}
+}
+
+func TestServeContentTooManyRanges(t *testing.T) {
+	content := strings.Repeat("x", 100)
+	h := HandlerFunc(func(req *Request) {
+		serveContent(req, StatusOK, Header{}, strings.NewReader(content), int64(len(content)), "", time.Time{})
+	})
+	spec := "bytes=0-0"
+	for i := 1; i <= maxRanges; i++ {
+		spec += "," + strconv.Itoa(i) + "-" + strconv.Itoa(i)
+	}
+	status, _, body := RunHandler("http://example.com/", "GET", NewHeader(HeaderRange, spec), nil, h)
+	if status != StatusOK || string(body) != content {
+		t.Errorf("status=%d, body length=%d, want full body", status, len(body))
+	}
+}
+
+var serveContentTests = []struct {
+	rangeHeader  string
+	status       int
+	contentRange string
+	body         string
+}{
+	{"", StatusOK, "", "0123456789"},
+	{"bytes=2-5", StatusPartialContent, "bytes 2-5/10", "2345"},
+	{"bytes=7-", StatusPartialContent, "bytes 7-9/10", "789"},
+	{"bytes=-3", StatusPartialContent, "bytes 7-9/10", "789"},
+	{"bytes=10-20", StatusOK, "", "0123456789"},
+	{"bytes=x-y", StatusRequestedRangeNotSatisfiable, "bytes */10", ""},
+}
+
+func TestServeContent(t *testing.T) {
+	const content = "0123456789"
+	modtime := time.Date(2011, 6, 1, 12, 0, 0, 0, time.UTC)
+	h := HandlerFunc(func(req *Request) {
+		req.ServeContent(modtime.Unix(), len(content), strings.NewReader(content), HeaderContentType, "text/plain")
+	})
+	for _, tt := range serveContentTests {
+		reqHeader := NewHeader()
+		if tt.rangeHeader != "" {
+			reqHeader.Set(HeaderRange, tt.rangeHeader)
+		}
+		status, header, body := RunHandler("http://example.com/", "GET", reqHeader, nil, h)
+		if status != tt.status {
+			t.Errorf("Range %q, status=%d, want %d", tt.rangeHeader, status, tt.status)
+			continue
+		}
+		if cr := header.Get(HeaderContentRange); cr != tt.contentRange {
+			t.Errorf("Range %q, Content-Range=%q, want %q", tt.rangeHeader, cr, tt.contentRange)
+		}
+		if status == StatusRequestedRangeNotSatisfiable {
+			continue
+		}
+		if string(body) != tt.body {
+			t.Errorf("Range %q, body=%q, want %q", tt.rangeHeader, body, tt.body)
+		}
+		if cl := header.Get(HeaderContentLength); cl != strconv.Itoa(len(tt.body)) {
+			t.Errorf("Range %q, Content-Length=%s, want %d", tt.rangeHeader, cl, len(tt.body))
+		}
+		if ar := header.Get(HeaderAcceptRanges); ar != "bytes" {
+			t.Errorf("Range %q, Accept-Ranges=%q, want bytes", tt.rangeHeader, ar)
+		}
+		if lm := header.Get(HeaderLastModified); lm != "Wed, 01 Jun 2011 12:00:00 GMT" {
+			t.Errorf("Range %q, Last-Modified=%q", tt.rangeHeader, lm)
+		}
+	}
+
+	// Range is ignored when If-Range date does not match.
+	reqHeader := NewHeader(HeaderRange, "bytes=2-5", HeaderIfRange, "Tue, 31 May 2011 12:00:00 GMT")
+	status, _, body := RunHandler("http://example.com/", "GET", reqHeader, nil, h)
+	if status != StatusOK || string(body) != content {
+		t.Errorf("stale If-Range, status=%d body=%q, want full body", status, body)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errRateLimited = errors.New("twister: rate limit exceeded")
+
+// RateLimitHandler returns a handler that limits the rate of requests from
+// each client IP address to rps requests per second with bursts of up to
+// burst requests. The limit is implemented with a token bucket per client.
+// Requests that exceed the limit get a response with status 429 and a
+// Retry-After header.
+//
+// The client IP address is the value returned by Request.ClientIP with no
+// trusted proxies. Requests relayed by a proxy share the proxy's bucket.
+// Buckets that have refilled are removed to bound memory use.
+func RateLimitHandler(rps int, burst int, h Handler) Handler {
+	if rps <= 0 || burst <= 0 {
+		panic("twister: rate limit rps and burst must be positive")
+	}
+	return &rateLimitHandler{
+		rate:    float64(rps),
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		h:       h,
+	}
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimitHandler struct {
+	rate  float64
+	burst float64
+	h     Handler
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// refill adds the tokens earned since the last update of b.
+func (rl *rateLimitHandler) refill(b *tokenBucket, now time.Time) {
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+}
+
+// sweep removes full buckets. A full bucket is equivalent to a missing
+// bucket.
+func (rl *rateLimitHandler) sweep(now time.Time) {
+	fill := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	if now.Sub(rl.lastSweep) < fill {
+		return
+	}
+	rl.lastSweep = now
+	for key, b := range rl.buckets {
+		rl.refill(b, now)
+		if b.tokens >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// take takes a token from the bucket for key. If the bucket is empty, then
+// take returns false and the number of seconds until a token is available.
+func (rl *rateLimitHandler) take(key string) (bool, int) {
+	now := nowFunc()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.sweep(now)
+	b := rl.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	} else {
+		rl.refill(b, now)
+	}
+	if b.tokens < 1 {
+		return false, int(math.Ceil((1 - b.tokens) / rl.rate))
+	}
+	b.tokens -= 1
+	return true, 0
+}
+
+func (rl *rateLimitHandler) ServeWeb(req *Request) {
+	if ok, retryAfter := rl.take(req.ClientIP()); !ok {
+		req.Error(StatusTooManyRequests, errRateLimited, HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return
+	}
+	rl.h.ServeWeb(req)
+}
@@ -0,0 +1,67 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	now := time.Unix(1300000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	h := RateLimitHandler(2, 3, HandlerFunc(func(req *Request) { req.Respond(StatusOK) }))
+	run := func(remoteAddr string) (int, Header) {
+		req, resp := NewTestRequest("GET", "http://example.com/", nil, nil)
+		req.RemoteAddr = remoteAddr
+		h.ServeWeb(req)
+		return resp.Status(), resp.Header()
+	}
+
+	for i := 0; i < 3; i++ {
+		if status, _ := run("1.2.3.4:1000"); status != StatusOK {
+			t.Fatalf("request %d, status=%d, want %d", i, status, StatusOK)
+		}
+	}
+	status, header := run("1.2.3.4:1001")
+	if status != StatusTooManyRequests {
+		t.Errorf("exhausted bucket, status=%d, want %d", status, StatusTooManyRequests)
+	}
+	if ra := header.Get(HeaderRetryAfter); ra != "1" {
+		t.Errorf("Retry-After=%q, want %q", ra, "1")
+	}
+	if status, _ := run("5.6.7.8:1000"); status != StatusOK {
+		t.Errorf("other client, status=%d, want %d", status, StatusOK)
+	}
+
+	// One token is added every half second.
+	now = now.Add(500 * time.Millisecond)
+	if status, _ := run("1.2.3.4:1000"); status != StatusOK {
+		t.Errorf("after refill, status=%d, want %d", status, StatusOK)
+	}
+	if status, _ := run("1.2.3.4:1000"); status != StatusTooManyRequests {
+		t.Errorf("after refill used, status=%d, want %d", status, StatusTooManyRequests)
+	}
+
+	// Full buckets are removed.
+	now = now.Add(time.Minute)
+	run("9.9.9.9:1000")
+	rl := h.(*rateLimitHandler)
+	if n := len(rl.buckets); n != 1 {
+		t.Errorf("buckets after sweep=%d, want 1", n)
+	}
+}
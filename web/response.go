@@ -0,0 +1,355 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ResponseInfo records information about a response. Use WrapResponder to
+// create a ResponseInfo.
+type ResponseInfo struct {
+	responded bool
+	status    int
+	header    Header
+	size      int64
+}
+
+// Responded returns true if the application called Respond.
+func (ri *ResponseInfo) Responded() bool { return ri.responded }
+
+// Status returns the status passed to Respond or 0 if the application did not
+// call Respond.
+func (ri *ResponseInfo) Status() int { return ri.status }
+
+// Header returns the header passed to Respond.
+func (ri *ResponseInfo) Header() Header { return ri.header }
+
+// Size returns the number of bytes written to the response body.
+func (ri *ResponseInfo) Size() int64 { return ri.size }
+
+// WrapResponder returns a responder that records the response to r in the
+// returned ResponseInfo. This function is intended to be used by middleware:
+//
+//  var info *web.ResponseInfo
+//  req.Responder, info = web.WrapResponder(req.Responder)
+//  h.ServeWeb(req)
+//  log.Println(req.URL, info.Status(), info.Size())
+func WrapResponder(r Responder) (Responder, *ResponseInfo) {
+	ri := &ResponseInfo{}
+	return &infoResponder{r, ri}, ri
+}
+
+type infoResponder struct {
+	Responder
+	ri *ResponseInfo
+}
+
+func (r *infoResponder) Respond(status int, header Header) io.Writer {
+	r.ri.responded = true
+	r.ri.status = status
+	r.ri.header = header
+	return &infoWriter{r.Responder.Respond(status, header), r.ri}
+}
+
+type infoWriter struct {
+	w  io.Writer
+	ri *ResponseInfo
+}
+
+func (w *infoWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.ri.size += int64(n)
+	return n, err
+}
+
+func (w *infoWriter) Flush() error {
+	if f, ok := w.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// ErrResponseTooLarge is returned by writes to a response body that exceed
+// the maximum size set with MaxResponseSizeHandler.
+var ErrResponseTooLarge = errors.New("twister: response too large")
+
+// MaxResponseSizeHandler returns a handler that limits the size of the
+// response body written by h to maxSize bytes. Writes that exceed the limit
+// return ErrResponseTooLarge. If the response body implements Aborter, then
+// the response is aborted and the server closes the connection so that the
+// client does not mistake the truncated body for a complete response.
+func MaxResponseSizeHandler(maxSize int64, h Handler) Handler {
+	return maxResponseSizeHandler{maxSize, h}
+}
+
+type maxResponseSizeHandler struct {
+	maxSize int64
+	h       Handler
+}
+
+func (h maxResponseSizeHandler) ServeWeb(req *Request) {
+	req.Responder = &maxSizeResponder{req.Responder, h.maxSize}
+	h.h.ServeWeb(req)
+}
+
+type maxSizeResponder struct {
+	Responder
+	maxSize int64
+}
+
+func (r *maxSizeResponder) Respond(status int, header Header) io.Writer {
+	return &maxSizeWriter{w: r.Responder.Respond(status, header), remaining: r.maxSize}
+}
+
+type maxSizeWriter struct {
+	w         io.Writer
+	remaining int64
+	err       error
+}
+
+func (w *maxSizeWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if int64(len(p)) <= w.remaining {
+		n, err := w.w.Write(p)
+		w.remaining -= int64(n)
+		return n, err
+	}
+	n, err := w.w.Write(p[:w.remaining])
+	w.remaining -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	w.err = ErrResponseTooLarge
+	if a, ok := w.w.(Aborter); ok {
+		a.Abort(w.err)
+	}
+	return n, w.err
+}
+
+func (w *maxSizeWriter) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if f, ok := w.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// BandwidthHandler returns a handler that limits the rate at which h writes
+// the response body to bytesPerSecond. The limit is implemented with a token
+// bucket that holds a tenth of a second of output. The response body is
+// flushed after each burst so that the output is paced on the network. An
+// error from the underlying response body, for example because the client
+// closed the connection, is returned immediately and ends the throttling.
+func BandwidthHandler(bytesPerSecond int, h Handler) Handler {
+	if bytesPerSecond <= 0 {
+		panic("twister: bandwidth must be positive")
+	}
+	return bandwidthHandler{bytesPerSecond, h}
+}
+
+type bandwidthHandler struct {
+	bytesPerSecond int
+	h              Handler
+}
+
+func (h bandwidthHandler) ServeWeb(req *Request) {
+	req.Responder = &bandwidthResponder{req.Responder, h.bytesPerSecond}
+	h.h.ServeWeb(req)
+}
+
+type bandwidthResponder struct {
+	Responder
+	bytesPerSecond int
+}
+
+func (r *bandwidthResponder) Respond(status int, header Header) io.Writer {
+	rate := float64(r.bytesPerSecond)
+	burst := rate / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &bandwidthWriter{
+		w:      r.Responder.Respond(status, header),
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   nowFunc(),
+	}
+}
+
+type bandwidthWriter struct {
+	w      io.Writer
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	err    error
+}
+
+func (w *bandwidthWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		now := nowFunc()
+		w.tokens += now.Sub(w.last).Seconds() * w.rate
+		if w.tokens > w.burst {
+			w.tokens = w.burst
+		}
+		w.last = now
+		if w.tokens < 1 {
+			sleepFunc(time.Duration((1 - w.tokens) / w.rate * float64(time.Second)))
+			continue
+		}
+		n := int(w.tokens)
+		if n > len(p) {
+			n = len(p)
+		}
+		n, err := w.w.Write(p[:n])
+		written += n
+		w.tokens -= float64(n)
+		p = p[n:]
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			w.err = err
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (w *bandwidthWriter) Flush() error {
+	if f, ok := w.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// MaxAutoContentLength is the maximum size of a response body buffered to
+// compute the Content-Length header. See Router.AutoContentLength.
+const MaxAutoContentLength = 64 * 1024
+
+// serveContentLength dispatches the request to h with a responder that
+// buffers the response body and sets the Content-Length header when the
+// handler returns. The header is not set for HEAD requests where the handler
+// does not write a body because the length of the GET response is not known.
+func serveContentLength(req *Request, h Handler) {
+	r := &contentLengthResponder{Responder: req.Responder}
+	req.Responder = r
+	h.ServeWeb(req)
+	if r.w != nil && r.w.buf != nil {
+		if req.Method != "HEAD" || r.w.buf.Len() > 0 {
+			r.w.header.Set(HeaderContentLength, strconv.Itoa(r.w.buf.Len()))
+		}
+		r.w.commit()
+	}
+}
+
+type contentLengthResponder struct {
+	Responder
+	w *contentLengthWriter
+}
+
+func (r *contentLengthResponder) Respond(status int, header Header) io.Writer {
+	if _, found := header[HeaderContentLength]; found || status == StatusNotModified || status == StatusNoContent {
+		return r.Responder.Respond(status, header)
+	}
+	r.w = &contentLengthWriter{r: r.Responder, status: status, header: header, buf: new(bytes.Buffer)}
+	return r.w
+}
+
+// contentLengthWriter buffers the response body until the body exceeds
+// MaxAutoContentLength or the handler flushes the response.
+type contentLengthWriter struct {
+	r      Responder
+	status int
+	header Header
+	buf    *bytes.Buffer
+	w      io.Writer
+	err    error
+}
+
+// commit sends the response header and the buffered body.
+func (w *contentLengthWriter) commit() {
+	w.w = w.r.Respond(w.status, w.header)
+	_, w.err = w.w.Write(w.buf.Bytes())
+	w.buf = nil
+}
+
+func (w *contentLengthWriter) Write(p []byte) (int, error) {
+	if w.buf != nil {
+		if w.buf.Len()+len(p) <= MaxAutoContentLength {
+			return w.buf.Write(p)
+		}
+		w.commit()
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.w.Write(p)
+}
+
+func (w *contentLengthWriter) Flush() error {
+	if w.buf != nil {
+		w.commit()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if f, ok := w.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Timings records the times that the first byte of a request arrived and the
+// first byte of the response was written. The server records the times when
+// supported by the server.
+type Timings struct {
+	RequestStart  time.Time
+	ResponseStart time.Time
+}
+
+// TTFB returns the time from the arrival of the first request byte to the
+// first response byte or 0 if either time was not recorded.
+func (t *Timings) TTFB() time.Duration {
+	if t.RequestStart.IsZero() || t.ResponseStart.IsZero() {
+		return 0
+	}
+	return t.ResponseStart.Sub(t.RequestStart)
+}
+
+// Timings returns the timings for the request. The timings are stored in the
+// request Env with the key "twister.web.Timings".
+func (req *Request) Timings() *Timings {
+	t, ok := req.Env["twister.web.Timings"].(*Timings)
+	if !ok {
+		t = &Timings{}
+		req.Env["twister.web.Timings"] = t
+	}
+	return t
+}
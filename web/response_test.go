@@ -0,0 +1,155 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrapResponder(t *testing.T) {
+	var info *ResponseInfo
+	h := HandlerFunc(func(req *Request) {
+		req.Responder, info = WrapResponder(req.Responder)
+		if info.Responded() || info.Status() != 0 {
+			t.Errorf("info before respond, responded=%v, status=%d", info.Responded(), info.Status())
+		}
+		w := req.Respond(StatusCreated, HeaderContentType, "text/plain")
+		io.WriteString(w, "hello, ")
+		io.WriteString(w, "world")
+		if _, ok := w.(Flusher); !ok {
+			t.Errorf("wrapped response body is not a Flusher")
+		}
+	})
+	status, _, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if !info.Responded() || info.Status() != status || info.Status() != StatusCreated {
+		t.Errorf("info responded=%v status=%d, want %d", info.Responded(), info.Status(), StatusCreated)
+	}
+	if info.Size() != int64(len(body)) || info.Size() != 12 {
+		t.Errorf("info size=%d, want %d", info.Size(), len(body))
+	}
+	if ct := info.Header().Get(HeaderContentType); ct != "text/plain" {
+		t.Errorf("info content type=%q", ct)
+	}
+}
+
+func TestMaxResponseSizeHandler(t *testing.T) {
+	var errs []error
+	h := MaxResponseSizeHandler(10, HandlerFunc(func(req *Request) {
+		w := req.Respond(StatusOK)
+		for _, s := range []string{"hello", "world", "!", "again"} {
+			_, err := io.WriteString(w, s)
+			errs = append(errs, err)
+		}
+	}))
+	_, _, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if string(body) != "helloworld" {
+		t.Errorf("body=%q, want %q", body, "helloworld")
+	}
+	want := []error{nil, nil, ErrResponseTooLarge, ErrResponseTooLarge}
+	for i := range want {
+		if errs[i] != want[i] {
+			t.Errorf("write %d, err=%v, want %v", i, errs[i], want[i])
+		}
+	}
+}
+
+func TestBandwidthHandler(t *testing.T) {
+	body := strings.Repeat("x", 300)
+	h := BandwidthHandler(1000, HandlerFunc(func(req *Request) {
+		io.WriteString(req.Respond(StatusOK), body)
+	}))
+	start := time.Now()
+	_, _, out := RunHandler("http://example.com/", "GET", nil, nil, h)
+	elapsed := time.Since(start)
+	if string(out) != body {
+		t.Errorf("body length=%d, want %d", len(out), len(body))
+	}
+	// The first 100 bytes are sent in a burst, the remaining 200 bytes are
+	// sent at 1000 bytes per second.
+	if elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("elapsed=%v, want about 200ms", elapsed)
+	}
+}
+
+func TestBandwidthHandlerClock(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	var slept time.Duration
+	defer func(nf func() time.Time, sf func(time.Duration)) {
+		nowFunc, sleepFunc = nf, sf
+	}(nowFunc, sleepFunc)
+	nowFunc = func() time.Time { return now }
+	sleepFunc = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	body := strings.Repeat("x", 300)
+	h := BandwidthHandler(1000, HandlerFunc(func(req *Request) {
+		io.WriteString(req.Respond(StatusOK), body)
+	}))
+	_, _, out := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if string(out) != body {
+		t.Errorf("body length=%d, want %d", len(out), len(body))
+	}
+	if slept < 190*time.Millisecond || slept > 210*time.Millisecond {
+		t.Errorf("slept=%v, want about 200ms", slept)
+	}
+}
+
+type errorResponder struct {
+	Responder
+	w *errorWriter
+}
+
+func (r errorResponder) Respond(status int, header Header) io.Writer {
+	return r.w
+}
+
+// errorWriter fails after n bytes to simulate a client disconnect.
+type errorWriter struct {
+	n int
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, io.ErrClosedPipe
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestBandwidthHandlerDisconnect(t *testing.T) {
+	var n int
+	var err error
+	h := HandlerFunc(func(req *Request) {
+		req.Responder = errorResponder{req.Responder, &errorWriter{150}}
+		BandwidthHandler(1000, HandlerFunc(func(req *Request) {
+			n, err = io.WriteString(req.Respond(StatusOK), strings.Repeat("x", 10000))
+		})).ServeWeb(req)
+	})
+	start := time.Now()
+	RunHandler("http://example.com/", "GET", nil, nil, h)
+	if err != io.ErrClosedPipe || n != 150 {
+		t.Errorf("n=%d, err=%v, want 150, %v", n, err, io.ErrClosedPipe)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("elapsed=%v, want write to end at disconnect", elapsed)
+	}
+}
@@ -16,8 +16,10 @@ package web
 
 import (
 	"bytes"
+	"errors"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -39,11 +41,17 @@ import (
 // A router dispatches requests by matching the request URL path against the
 // registered route patterns in the order that the routes were registered. If a
 // matching route is not found, then the router responds to the request with
-// HTTP status 404.
+// HTTP status 404 or dispatches the request to the handler set with
+// SetNotFound.
 // 
 // If a matching route is found, then the router looks for a handler using the 
-// request method, "GET" if the request method is "HEAD" and "*". If a handler
-// is not found, then the router responds to the request with HTTP status 405.
+// request method, "GET" if the request method is "HEAD" and "*", in that
+// order. A handler registered for a specific method takes precedence over a
+// "*" handler on the same route. The "*" handler receives HEAD requests only
+// when the route does not have a GET handler. If a handler is not found, then
+// the router responds to the request with HTTP status 405 or dispatches the
+// request to the handler set with SetMethodNotAllowed. The Allow header in the
+// 405 response lists the methods registered for the route.
 //
 // Any matching parameters are in route pattern are stored in the in the
 // request URLParam field.
@@ -52,10 +60,24 @@ import (
 // trailing slash to the URL with the trailing slash.
 //
 type Router struct {
-	routes []*route
+	routes      []*route
+	cors        *CORSOptions
+	maxPathLen  int
+	maxSegments int
+
+	notFound         Handler
+	methodNotAllowed Handler
+
+	autoContentLength bool
+
+	// Set for routers returned by Group.
+	parent     *Router
+	prefix     string
+	middleware []Middleware
 }
 
 type route struct {
+	pattern  string
 	addSlash bool
 	regexp   *regexp.Regexp
 	names    []string
@@ -65,24 +87,29 @@ type route struct {
 var parameterRegexp = regexp.MustCompile("<([A-Za-z0-9_]*)(:[^>]*)?>")
 
 // compilePattern compiles the pattern to a regular expression and array of
-// parameter names.
+// parameter names. An error is returned if the pattern has an unterminated
+// parameter or an invalid regular expression.
 func compilePattern(pattern string, addSlash bool, sep string) (*regexp.Regexp,
-	[]string) {
+	[]string, error) {
 	var buf bytes.Buffer
-	names := make([]string, 8)
-	i := 0
+	var names []string
 	buf.WriteString("^")
 	for {
 		a := parameterRegexp.FindStringSubmatchIndex(pattern)
 		if len(a) == 0 {
+			if strings.ContainsAny(pattern, "<>") {
+				return nil, nil, errors.New("twister: Malformed parameter in route pattern")
+			}
 			buf.WriteString(regexp.QuoteMeta(pattern))
 			break
 		} else {
+			if strings.ContainsAny(pattern[0:a[0]], "<>") {
+				return nil, nil, errors.New("twister: Malformed parameter in route pattern")
+			}
 			buf.WriteString(regexp.QuoteMeta(pattern[0:a[0]]))
 			name := pattern[a[2]:a[3]]
 			if name != "" {
-				names[i] = pattern[a[2]:a[3]]
-				i += 1
+				names = append(names, name)
 				buf.WriteString("(")
 			}
 			if a[4] >= 0 {
@@ -100,7 +127,11 @@ func compilePattern(pattern string, addSlash bool, sep string) (*regexp.Regexp,
 		buf.WriteString("?")
 	}
 	buf.WriteString("$")
-	return regexp.MustCompile(buf.String()), names[0:i]
+	re, err := regexp.Compile(buf.String())
+	if err != nil {
+		return nil, nil, errors.New("twister: Bad regular expression in route pattern, " + err.Error())
+	}
+	return re, names, nil
 }
 
 // Register the route with the given pattern and handlers. The structure of the
@@ -110,22 +141,47 @@ func compilePattern(pattern string, addSlash bool, sep string) (*regexp.Regexp,
 //
 // where method is a string and handler is a Handler or a
 // func(*Request). Use "*" to match all methods.
+//
+// Register panics if the route is not valid. Use TryRegister to get an error
+// instead.
 func (router *Router) Register(pattern string, handlers ...interface{}) *Router {
+	if err := router.TryRegister(pattern, handlers...); err != nil {
+		panic(err.Error())
+	}
+	return router
+}
+
+// TryRegister registers the route with the given pattern and handlers as
+// Register does. TryRegister returns an error if the pattern is malformed,
+// the handlers argument does not have the structure described for Register
+// or a handler is already registered for the pattern and method. The route is
+// not registered if an error is returned.
+func (router *Router) TryRegister(pattern string, handlers ...interface{}) error {
 	if pattern == "" || pattern[0] != '/' {
-		panic("twister: Invalid route pattern " + pattern)
+		return errors.New("twister: Invalid route pattern " + pattern)
+	}
+	if router.parent != nil {
+		return router.parent.TryRegister(router.prefix+pattern, router.wrap(handlers)...)
 	}
 	if len(handlers)%2 != 0 || len(handlers) == 0 {
-		panic("twister: Invalid handlers for pattern " + pattern +
+		return errors.New("twister: Invalid handlers for pattern " + pattern +
 			". Structure of handlers is [method handler]+.")
 	}
-	r := route{}
+	r := route{pattern: pattern}
 	r.addSlash = pattern[len(pattern)-1] == '/'
-	r.regexp, r.names = compilePattern(pattern, r.addSlash, "/")
+	var err error
+	r.regexp, r.names, err = compilePattern(pattern, r.addSlash, "/")
+	if err != nil {
+		return errors.New(err.Error() + " " + pattern)
+	}
 	r.handlers = make(map[string]Handler)
 	for i := 0; i < len(handlers); i += 2 {
 		method, ok := handlers[i].(string)
 		if !ok {
-			panic("twister: Bad method for pattern " + pattern)
+			return errors.New("twister: Bad method for pattern " + pattern)
+		}
+		if _, found := r.handlers[method]; found || router.registered(pattern, method) {
+			return errors.New("twister: Duplicate route for pattern " + pattern + " and method " + method)
 		}
 		switch handler := handlers[i+1].(type) {
 		case Handler:
@@ -133,11 +189,87 @@ func (router *Router) Register(pattern string, handlers ...interface{}) *Router
 		case func(*Request):
 			r.handlers[method] = HandlerFunc(handler)
 		default:
-			panic("twister: Bad handler for pattern " + pattern + " and method " + method)
+			return errors.New("twister: Bad handler for pattern " + pattern + " and method " + method)
 		}
 	}
 	router.routes = append(router.routes, &r)
-	return router
+	return nil
+}
+
+// Group returns a router for registering routes with patterns that start
+// with prefix. The handlers registered with the returned router are wrapped
+// with the middleware in mw, with mw[0] as the outermost handler, and are
+// added to the routes of router:
+//
+//  admin := router.Group("/admin", requireAdmin)
+//  admin.Register("/users", "GET", listUsers) // handles /admin/users
+//
+// The returned router is used for registration only. The router settings
+// such as SetNotFound do not apply to the returned router.
+func (router *Router) Group(prefix string, mw ...Middleware) *Router {
+	if prefix == "" || prefix[0] != '/' {
+		panic("twister: Invalid route group prefix " + prefix)
+	}
+	return &Router{parent: router, prefix: strings.TrimRight(prefix, "/"), middleware: mw}
+}
+
+// wrap returns a copy of handlers with the handlers wrapped in the router's
+// middleware. Malformed elements are not modified so that the error is
+// reported by the parent router.
+func (router *Router) wrap(handlers []interface{}) []interface{} {
+	wrapped := make([]interface{}, len(handlers))
+	copy(wrapped, handlers)
+	for i := 1; i < len(wrapped); i += 2 {
+		var h Handler
+		switch handler := wrapped[i].(type) {
+		case Handler:
+			h = handler
+		case func(*Request):
+			h = HandlerFunc(handler)
+		default:
+			continue
+		}
+		for j := len(router.middleware) - 1; j >= 0; j-- {
+			h = router.middleware[j](h)
+		}
+		wrapped[i] = h
+	}
+	return wrapped
+}
+
+// registered returns true if a handler is registered for pattern and method.
+func (router *Router) registered(pattern, method string) bool {
+	for _, r := range router.routes {
+		if r.pattern == pattern && r.handlers[method] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterFunc registers the route with the given pattern and functions. The
+// structure of the arguments following the pattern is:
+//
+//  (method func(*Request))+
+//
+// RegisterFunc is a type checked version of Register for applications that
+// register plain functions:
+//
+//  router.RegisterFunc("/", "GET", home, "POST", updateHome)
+func (router *Router) RegisterFunc(pattern string, method string, fn func(*Request), methodsAndFuncs ...interface{}) *Router {
+	if len(methodsAndFuncs)%2 != 0 {
+		panic("twister: Invalid functions for pattern " + pattern +
+			". Structure of functions is [method func(*Request)]+.")
+	}
+	handlers := []interface{}{method, HandlerFunc(fn)}
+	for i := 0; i < len(methodsAndFuncs); i += 2 {
+		f, ok := methodsAndFuncs[i+1].(func(*Request))
+		if !ok {
+			panic("twister: Bad function for pattern " + pattern)
+		}
+		handlers = append(handlers, methodsAndFuncs[i], HandlerFunc(f))
+	}
+	return router.Register(pattern, handlers...)
 }
 
 type routerError int
@@ -178,7 +310,14 @@ func (router *Router) find(path string, method string) (Handler, []string, []str
 		if handler := r.handlers["*"]; handler != nil {
 			return handler, r.names, values
 		}
-		return routerError(StatusMethodNotAllowed), nil, nil
+		allow := strings.Join(r.methods(), ", ")
+		if router.methodNotAllowed != nil {
+			return methodNotAllowedHandler{allow, router.methodNotAllowed}, r.names, values
+		}
+		return methodNotAllowedHandler{allow, routerError(StatusMethodNotAllowed)}, nil, nil
+	}
+	if router.notFound != nil {
+		return router.notFound, nil, nil
 	}
 	return routerError(StatusNotFound), nil, nil
 }
@@ -195,13 +334,164 @@ func cleanUrlPath(p string) string {
 	return p
 }
 
+// SetNotFound sets the handler for requests that do not match a route. The
+// default handler responds with status 404.
+func (router *Router) SetNotFound(h Handler) *Router {
+	router.notFound = h
+	return router
+}
+
+// SetMethodNotAllowed sets the handler for requests that match a route
+// without a handler for the request method. The parameters matched by the
+// route are stored in the request URLParam field. The default handler
+// responds with status 405.
+func (router *Router) SetMethodNotAllowed(h Handler) *Router {
+	router.methodNotAllowed = h
+	return router
+}
+
+// AutoContentLength enables buffering of responses to GET and HEAD requests
+// so that the router can set the Content-Length header. Responses that
+// already have a Content-Length header are not buffered. If the response body
+// exceeds MaxAutoContentLength bytes or the handler flushes the response, then
+// the response is sent without a Content-Length header.
+func (router *Router) AutoContentLength(enable bool) *Router {
+	router.autoContentLength = enable
+	return router
+}
+
+// Limit sets the maximum length of the request URL path and the maximum
+// number of '/' separated segments in the path. The router responds with
+// status 414 to requests that exceed either limit without matching the path
+// against the routes. A limit of zero disables the check.
+func (router *Router) Limit(maxPathLen, maxSegments int) *Router {
+	router.maxPathLen = maxPathLen
+	router.maxSegments = maxSegments
+	return router
+}
+
+// CORS enables cross-origin resource sharing for all routes in the router.
+// The router adds the CORS headers to responses for requests from allowed
+// origins. The router responds to preflight requests with the methods
+// registered for the route matching the request path. If opts.AllowMethods
+// is not empty, then the allowed methods are limited to the methods in
+// opts.AllowMethods.
+//
+// Preflight requests for a route with an "OPTIONS" handler are dispatched to
+// the handler. The router adds the origin headers to the handler's response.
+func (router *Router) CORS(opts CORSOptions) *Router {
+	opts.check()
+	router.cors = &opts
+	return router
+}
+
+// routeMethods returns the methods allowed for the route matching path or nil
+// if there is no matching route. The second result is true if the route has
+// an OPTIONS handler.
+func (router *Router) routeMethods(path string) ([]string, bool) {
+	for _, r := range router.routes {
+		if !r.regexp.MatchString(path) {
+			continue
+		}
+		if _, ok := r.handlers["*"]; ok {
+			return router.cors.methods(), r.handlers["OPTIONS"] != nil
+		}
+		return r.methods(), r.handlers["OPTIONS"] != nil
+	}
+	return nil, false
+}
+
+// methods returns the sorted list of methods with a handler on the route.
+// HEAD is included if the route has a GET handler.
+func (r *route) methods() []string {
+	var methods []string
+	for m := range r.handlers {
+		methods = append(methods, m)
+	}
+	if r.handlers["GET"] != nil && r.handlers["HEAD"] == nil {
+		methods = append(methods, "HEAD")
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// methodNotAllowedHandler adds the Allow header to responses with status 405
+// from h.
+type methodNotAllowedHandler struct {
+	allow string
+	h     Handler
+}
+
+func (h methodNotAllowedHandler) ServeWeb(req *Request) {
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		if status == StatusMethodNotAllowed && header.Get(HeaderAllow) == "" {
+			header.Set(HeaderAllow, h.allow)
+		}
+		return status, header
+	})
+	h.h.ServeWeb(req)
+}
+
+// serveCORS handles CORS for the request. It returns true if the request was
+// handled.
+func (router *Router) serveCORS(req *Request, p string) bool {
+	origin := req.Header.Get(HeaderOrigin)
+	if origin == "" || !router.cors.allowOrigin(origin) {
+		return false
+	}
+	if isPreflight(req) {
+		methods, hasOptions := router.routeMethods(p)
+		if methods == nil {
+			req.Error(StatusNotFound, nil)
+			return true
+		}
+		if !hasOptions {
+			if len(router.cors.AllowMethods) > 0 {
+				methods = intersectMethods(methods, router.cors.AllowMethods)
+			}
+			router.cors.preflight(req, origin, methods)
+			return true
+		}
+	}
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		router.cors.setOriginHeaders(origin, header)
+		if len(router.cors.ExposeHeaders) > 0 {
+			header.Set(HeaderAccessControlExposeHeaders, strings.Join(router.cors.ExposeHeaders, ", "))
+		}
+		return status, header
+	})
+	return false
+}
+
+// intersectMethods returns the methods in a that are also in b.
+func intersectMethods(a, b []string) []string {
+	var result []string
+	for _, m := range a {
+		for _, n := range b {
+			if m == n {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return result
+}
+
 // ServeWeb dispatches the request to a registered handler.
 func (router *Router) ServeWeb(req *Request) {
+	if (router.maxPathLen > 0 && len(req.URL.Path) > router.maxPathLen) ||
+		(router.maxSegments > 0 && strings.Count(req.URL.Path, "/") > router.maxSegments) {
+		req.Error(StatusRequestURITooLong, nil)
+		return
+	}
 	p := cleanUrlPath(req.URL.Path)
 	if p != req.URL.Path {
 		req.Redirect(p, true)
 		return
 	}
+	if router.cors != nil && router.serveCORS(req, p) {
+		return
+	}
 	handler, names, values := router.find(p, req.Method)
 	if req.URLParam == nil {
 		req.URLParam = make(map[string]string, len(values))
@@ -209,6 +499,10 @@ func (router *Router) ServeWeb(req *Request) {
 	for i := 0; i < len(names); i++ {
 		req.URLParam[names[i]] = values[i]
 	}
+	if router.autoContentLength && (req.Method == "GET" || req.Method == "HEAD") {
+		serveContentLength(req, handler)
+		return
+	}
 	handler.ServeWeb(req)
 }
 
@@ -233,7 +527,10 @@ func NewRouter() *Router {
 // [^.]+ is used.
 //
 // Any matching parameters are in route pattern are stored in the in the
-// request URLParam field.
+// request URLParam field. The parameters are also set in the request Param
+// field so that handlers can read values such as a tenant name from the host
+// in the same way as other request parameters. Host parameters replace any
+// request parameters with the same name.
 type HostRouter struct {
 	defaultHandler Handler
 	routes         []hostRoute
@@ -255,7 +552,10 @@ func NewHostRouter(defaultHandler Handler) *HostRouter {
 
 // Register a handler for the given pattern.
 func (router *HostRouter) Register(hostPattern string, handler Handler) *HostRouter {
-	regex, names := compilePattern(hostPattern, false, ".")
+	regex, names, err := compilePattern(hostPattern, false, ".")
+	if err != nil {
+		panic(err.Error() + " " + hostPattern)
+	}
 	router.routes = append(router.routes, hostRoute{regexp: regex, names: names, handler: handler})
 	return router
 }
@@ -281,6 +581,7 @@ func (router *HostRouter) ServeWeb(req *Request) {
 	}
 	for i := 0; i < len(names); i++ {
 		req.URLParam[names[i]] = values[i]
+		req.Param.Set(names[i], values[i])
 	}
 	handler.ServeWeb(req)
 }
@@ -15,7 +15,11 @@
 package web
 
 import (
+	"io"
+	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -92,6 +96,202 @@ func TestRouter(t *testing.T) {
 	}
 }
 
+func TestRouterRegisterFunc(t *testing.T) {
+	r := NewRouter()
+	r.RegisterFunc("/<x>", "GET", func(req *Request) {
+		io.WriteString(req.Respond(StatusOK), "get "+req.URLParam["x"])
+	}, "POST", func(req *Request) {
+		io.WriteString(req.Respond(StatusOK), "post "+req.URLParam["x"])
+	})
+	for _, method := range []string{"GET", "POST"} {
+		status, _, body := RunHandler("/foo", method, nil, nil, r)
+		want := strings.ToLower(method) + " foo"
+		if status != StatusOK || string(body) != want {
+			t.Errorf("method=%s, status=%d body=%q, want %d %q", method, status, body, StatusOK, want)
+		}
+	}
+	if status, _, _ := RunHandler("/foo", "PUT", nil, nil, r); status != StatusMethodNotAllowed {
+		t.Errorf("method=PUT, status=%d, want %d", status, StatusMethodNotAllowed)
+	}
+}
+
+func TestRouterSetNotFound(t *testing.T) {
+	r := NewRouter().
+		Register("/a/<x>", "GET", routeTestHandler("a")).
+		SetNotFound(HandlerFunc(func(req *Request) {
+			io.WriteString(req.Respond(StatusNotFound), "custom not found")
+		})).
+		SetMethodNotAllowed(HandlerFunc(func(req *Request) {
+			io.WriteString(req.Respond(StatusMethodNotAllowed), "custom not allowed "+req.URLParam["x"])
+		}))
+	status, _, body := RunHandler("/b", "GET", nil, nil, r)
+	if status != StatusNotFound || string(body) != "custom not found" {
+		t.Errorf("not found, status=%d body=%q", status, body)
+	}
+	status, _, body = RunHandler("/a/foo", "POST", nil, nil, r)
+	if status != StatusMethodNotAllowed || string(body) != "custom not allowed foo" {
+		t.Errorf("method not allowed, status=%d body=%q", status, body)
+	}
+}
+
+var tryRegisterTests = []struct {
+	pattern  string
+	handlers []interface{}
+	ok       bool
+}{
+	{"/a", []interface{}{"GET", routeTestHandler("a")}, true},
+	{"/a", []interface{}{"POST", routeTestHandler("a")}, true},
+	{"/a", []interface{}{"GET", routeTestHandler("a")}, false},
+	{"/b", []interface{}{"GET", routeTestHandler("b"), "GET", routeTestHandler("b")}, false},
+	{"/x/<unclosed", []interface{}{"GET", routeTestHandler("x")}, false},
+	{"/x/unopened>", []interface{}{"GET", routeTestHandler("x")}, false},
+	{"/x/<y:[0-9>/z", []interface{}{"GET", routeTestHandler("x")}, false},
+	{"/x/<y>/<z", []interface{}{"GET", routeTestHandler("x")}, false},
+	{"/a/<a>/<b>/<c>/<d>/<e>/<f>/<g>/<h>/<i>", []interface{}{"GET", routeTestHandler("x")}, true},
+	{"x", []interface{}{"GET", routeTestHandler("x")}, false},
+	{"/c", []interface{}{"GET"}, false},
+	{"/c", []interface{}{"GET", "handler"}, false},
+}
+
+func TestRouterTryRegister(t *testing.T) {
+	r := NewRouter()
+	for _, tt := range tryRegisterTests {
+		n := len(r.routes)
+		err := r.TryRegister(tt.pattern, tt.handlers...)
+		if (err == nil) != tt.ok {
+			t.Errorf("TryRegister(%q, %v) = %v, want ok=%v", tt.pattern, tt.handlers, err, tt.ok)
+		}
+		if err != nil && len(r.routes) != n {
+			t.Errorf("TryRegister(%q, %v) registered route on error", tt.pattern, tt.handlers)
+		}
+	}
+}
+
+var routerLimitTests = []struct {
+	path   string
+	status int
+}{
+	{"/a/b/c", StatusOK},
+	{"/a/b/c/", StatusOK},
+	{"/a/b/c/d", StatusOK},
+	{"/a/b/c/d/", StatusRequestURITooLong},
+	{"/a/b/c/d/e", StatusRequestURITooLong},
+	{"/" + strings.Repeat("a", 19), StatusOK},
+	{"/" + strings.Repeat("a", 20), StatusRequestURITooLong},
+}
+
+func TestRouterLimit(t *testing.T) {
+	r := NewRouter().Limit(20, 4).Register("/<x:.*>", "GET", routeTestHandler("x"))
+	for _, tt := range routerLimitTests {
+		if status, _, _ := RunHandler(tt.path, "GET", nil, nil, r); status != tt.status {
+			t.Errorf("path=%s, status=%d, want %d", tt.path, status, tt.status)
+		}
+	}
+}
+
+var wildcardMethodTests = []struct {
+	method string
+	body   string
+}{
+	{"GET", "get"},
+	{"HEAD", "get"},
+	{"POST", "post"},
+	{"PUT", "*"},
+	{"DELETE", "*"},
+	{"OPTIONS", "*"},
+}
+
+func TestRouterWildcardMethod(t *testing.T) {
+	// Register "*" before and after the specific methods to show that
+	// registration order does not matter.
+	routers := []*Router{
+		NewRouter().Register("/", "*", routeTestHandler("*"), "GET", routeTestHandler("get"), "POST", routeTestHandler("post")),
+		NewRouter().Register("/", "GET", routeTestHandler("get"), "POST", routeTestHandler("post"), "*", routeTestHandler("*")),
+	}
+	for i, r := range routers {
+		for _, tt := range wildcardMethodTests {
+			status, _, body := RunHandler("/", tt.method, nil, nil, r)
+			if status != StatusOK || string(body) != tt.body {
+				t.Errorf("router %d, method=%s, status=%d body=%q, want %d %q", i, tt.method, status, body, StatusOK, tt.body)
+			}
+		}
+	}
+	r := NewRouter().Register("/", "POST", routeTestHandler("post"), "*", routeTestHandler("*"))
+	if _, _, body := RunHandler("/", "HEAD", nil, nil, r); string(body) != "*" {
+		t.Errorf("HEAD without GET handler, body=%q, want %q", body, "*")
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(req *Request) {
+				calls = append(calls, name)
+				h.ServeWeb(req)
+			})
+		}
+	}
+	r := NewRouter().Register("/public", "GET", routeTestHandler("public"))
+	admin := r.Group("/admin/", tag("auth"), tag("log"))
+	admin.Register("/users/<id>", "GET", routeTestHandler("user"))
+	admin.Group("/reports", tag("audit")).Register("/", "GET", func(req *Request) {
+		io.WriteString(req.Respond(StatusOK), "reports")
+	})
+
+	for _, tt := range []struct {
+		url   string
+		body  string
+		calls []string
+	}{
+		{"/public", "public", nil},
+		{"/admin/users/42", "user id:42", []string{"auth", "log"}},
+		{"/admin/reports/", "reports", []string{"auth", "log", "audit"}},
+	} {
+		calls = nil
+		status, _, body := RunHandler(tt.url, "GET", nil, nil, r)
+		if status != StatusOK || string(body) != tt.body {
+			t.Errorf("%s, status=%d body=%q, want %d %q", tt.url, status, body, StatusOK, tt.body)
+		}
+		if !reflect.DeepEqual(calls, tt.calls) {
+			t.Errorf("%s, middleware calls=%v, want %v", tt.url, calls, tt.calls)
+		}
+	}
+	if status, _, _ := RunHandler("/users/42", "GET", nil, nil, r); status != StatusNotFound {
+		t.Errorf("unprefixed group route status=%d, want %d", status, StatusNotFound)
+	}
+}
+
+func TestRouterPatch(t *testing.T) {
+	r := NewRouter().Register("/items/<id>", "GET", routeTestHandler("get"), "PATCH", routeTestHandler("patch"))
+	status, _, body := RunHandler("/items/1", "PATCH", nil, nil, r)
+	if status != StatusOK || string(body) != "patch id:1" {
+		t.Errorf("PATCH status=%d body=%q, want %d %q", status, body, StatusOK, "patch id:1")
+	}
+	status, header, _ := RunHandler("/items/1", "DELETE", nil, nil, r)
+	if status != StatusMethodNotAllowed {
+		t.Errorf("DELETE status=%d, want %d", status, StatusMethodNotAllowed)
+	}
+	if allow := header.Get(HeaderAllow); allow != "GET, HEAD, PATCH" {
+		t.Errorf("Allow=%q, want %q", allow, "GET, HEAD, PATCH")
+	}
+
+	// Method override to PATCH.
+	h := MethodOverrideHandler(r)
+	status, _, body = RunHandler("/items/2", "POST", NewHeader(HeaderXHTTPMethodOverride, "PATCH"), nil, h)
+	if status != StatusOK || string(body) != "patch id:2" {
+		t.Errorf("override status=%d body=%q, want %d %q", status, body, StatusOK, "patch id:2")
+	}
+
+	// The custom handler gets the Allow header too.
+	r.SetMethodNotAllowed(HandlerFunc(func(req *Request) {
+		req.Respond(StatusMethodNotAllowed)
+	}))
+	if _, header, _ := RunHandler("/items/1", "PUT", nil, nil, r); header.Get(HeaderAllow) != "GET, HEAD, PATCH" {
+		t.Errorf("custom handler Allow=%q, want %q", header.Get(HeaderAllow), "GET, HEAD, PATCH")
+	}
+}
+
 var hostRouteTests = []struct {
 	url    string
 	status int
@@ -119,3 +319,153 @@ func TestHostRouter(t *testing.T) {
 		}
 	}
 }
+
+type hostParamTestHandler []string
+
+func (h hostParamTestHandler) ServeWeb(req *Request) {
+	w := req.Respond(StatusOK)
+	for i, name := range h {
+		if i > 0 {
+			w.Write([]byte(" "))
+		}
+		w.Write([]byte(name))
+		w.Write([]byte(":"))
+		w.Write([]byte(req.Param.Get(name)))
+	}
+}
+
+var hostParamTests = []struct {
+	url  string
+	body string
+}{
+	{url: "http://acme.example.com/", body: "tenant:acme"},
+	{url: "http://acme.example.com/?tenant=evil", body: "tenant:acme"},
+	{url: "http://acme.us.example.net/", body: "tenant:acme region:us"},
+}
+
+func TestHostRouterParam(t *testing.T) {
+	r := NewHostRouter(nil)
+	r.Register("<tenant>.example.com", hostParamTestHandler{"tenant"})
+	r.Register("<tenant>.<region>.example.net", hostParamTestHandler{"tenant", "region"})
+
+	for _, tt := range hostParamTests {
+		status, _, body := RunHandler(tt.url, "GET", nil, nil, r)
+		if status != StatusOK {
+			t.Errorf("url=%s, status=%d, want %d", tt.url, status, StatusOK)
+			continue
+		}
+		if string(body) != tt.body {
+			t.Errorf("url=%s, body=%q, want %q", tt.url, string(body), tt.body)
+		}
+	}
+}
+
+func TestRouterCORS(t *testing.T) {
+	ok := func(req *Request) { req.Respond(StatusOK) }
+	router := NewRouter().
+		CORS(CORSOptions{AllowOrigins: []string{"example.org"}}).
+		Register("/a", "GET", ok).
+		Register("/b", "GET", ok, "PUT", ok, "DELETE", ok).
+		Register("/c", "GET", ok, "OPTIONS", func(req *Request) { req.Respond(StatusOK, HeaderAllow, "GET, OPTIONS") })
+
+	preflight := func(path string) (int, Header) {
+		status, header, _ := RunHandler("http://example.com"+path, "OPTIONS", NewHeader(
+			HeaderOrigin, "http://example.org",
+			HeaderAccessControlRequestMethod, "GET"), nil, router)
+		return status, header
+	}
+
+	status, header := preflight("/a")
+	if status != StatusNoContent {
+		t.Errorf("/a status=%d, want %d", status, StatusNoContent)
+	}
+	if s := header.Get(HeaderAccessControlAllowMethods); s != "GET, HEAD" {
+		t.Errorf("/a allow methods=%q, want %q", s, "GET, HEAD")
+	}
+	if s := header.Get(HeaderAccessControlAllowOrigin); s != "http://example.org" {
+		t.Errorf("/a allow origin=%q", s)
+	}
+
+	if _, header := preflight("/b"); header.Get(HeaderAccessControlAllowMethods) != "DELETE, GET, HEAD, PUT" {
+		t.Errorf("/b allow methods=%q", header.Get(HeaderAccessControlAllowMethods))
+	}
+
+	status, header = preflight("/c")
+	if status != StatusOK || header.Get(HeaderAllow) != "GET, OPTIONS" {
+		t.Errorf("/c status=%d header=%v, want route OPTIONS handler", status, header)
+	}
+	if s := header.Get(HeaderAccessControlAllowOrigin); s != "http://example.org" {
+		t.Errorf("/c allow origin=%q", s)
+	}
+
+	if status, _ := preflight("/x"); status != StatusNotFound {
+		t.Errorf("/x status=%d, want %d", status, StatusNotFound)
+	}
+
+	status, header, _ = RunHandler("http://example.com/a", "GET", NewHeader(HeaderOrigin, "http://example.org"), nil, router)
+	if status != StatusOK || header.Get(HeaderAccessControlAllowOrigin) != "http://example.org" {
+		t.Errorf("GET /a status=%d header=%v", status, header)
+	}
+	status, header, _ = RunHandler("http://example.com/a", "GET", NewHeader(HeaderOrigin, "http://evil.example"), nil, router)
+	if status != StatusOK || header.Get(HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("GET /a from disallowed origin status=%d header=%v", status, header)
+	}
+}
+
+func TestRouterAutoContentLength(t *testing.T) {
+	r := NewRouter().AutoContentLength(true).
+		Register("/<n:[0-9]+>", "GET", func(req *Request) {
+			n, _ := strconv.Atoi(req.URLParam["n"])
+			w := req.Respond(StatusOK)
+			for i := 0; i < n; i += 1000 {
+				io.WriteString(w, strings.Repeat("x", 1000))
+			}
+		}).
+		Register("/flush", "GET", func(req *Request) {
+			w := req.Respond(StatusOK)
+			io.WriteString(w, "hello")
+			w.(Flusher).Flush()
+		}).
+		Register("/explicit", "GET", func(req *Request) {
+			io.WriteString(req.Respond(StatusOK, HeaderContentLength, "5"), "hello")
+		}).
+		Register("/nobody", "GET", func(req *Request) {
+			w := req.Respond(StatusOK)
+			if req.Method == "GET" {
+				io.WriteString(w, "hello")
+			}
+		})
+
+	for _, tt := range []struct {
+		path          string
+		contentLength string
+	}{
+		{"/0", "0"},
+		{"/3000", "3000"},
+		{"/65000", "65000"},
+		{"/66000", ""},
+		{"/flush", ""},
+		{"/explicit", "5"},
+	} {
+		status, header, body := RunHandler(tt.path, "GET", nil, nil, r)
+		if status != StatusOK {
+			t.Errorf("%s, status=%d, want %d", tt.path, status, StatusOK)
+		}
+		if cl := header.Get(HeaderContentLength); cl != tt.contentLength {
+			t.Errorf("%s, Content-Length=%q, want %q", tt.path, cl, tt.contentLength)
+		} else if cl != "" && cl != strconv.Itoa(len(body)) {
+			t.Errorf("%s, Content-Length=%q, body length %d", tt.path, cl, len(body))
+		}
+		if tt.path == "/3000" {
+			_, header, _ = RunHandler(tt.path, "HEAD", nil, nil, r)
+			if cl := header.Get(HeaderContentLength); cl != "3000" {
+				t.Errorf("HEAD %s, Content-Length=%q, want 3000", tt.path, cl)
+			}
+		}
+	}
+
+	// A HEAD response without a body does not get Content-Length: 0.
+	if _, header, _ := RunHandler("/nobody", "HEAD", nil, nil, r); header.Get(HeaderContentLength) != "" {
+		t.Errorf("HEAD /nobody, Content-Length=%q, want none", header.Get(HeaderContentLength))
+	}
+}
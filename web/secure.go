@@ -0,0 +1,238 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SecureHeadersOptions specifies the security related response headers set
+// by SecureHeadersHandler. Headers with an empty value are not set.
+type SecureHeadersOptions struct {
+	// If true, set "X-Content-Type-Options: nosniff".
+	NoSniff bool
+
+	// Value of the X-Frame-Options header, for example "DENY" or
+	// "SAMEORIGIN".
+	FrameOptions string
+
+	// Value of the Referrer-Policy header. The value must be one of the
+	// policies defined in the Referrer Policy specification, for example
+	// "no-referrer" or "strict-origin-when-cross-origin".
+	ReferrerPolicy string
+
+	// Value of the Permissions-Policy header.
+	PermissionsPolicy *PermissionsPolicy
+}
+
+// PermissionsPolicy builds the value of a Permissions-Policy header. The zero
+// value is an empty policy.
+//
+//  p := new(web.PermissionsPolicy).Set("geolocation").Set("camera", "self")
+//  p.String() // geolocation=(), camera=(self)
+type PermissionsPolicy struct {
+	features  []string
+	allowlist map[string][]string
+}
+
+// Set sets the allowlist for a feature. The allowlist entries are "self",
+// "src", "*" or origins such as "https://example.com". An empty allowlist
+// disables the feature. Set returns the policy to allow chaining.
+func (p *PermissionsPolicy) Set(feature string, allowlist ...string) *PermissionsPolicy {
+	if p.allowlist == nil {
+		p.allowlist = make(map[string][]string)
+	}
+	if _, found := p.allowlist[feature]; !found {
+		p.features = append(p.features, feature)
+	}
+	p.allowlist[feature] = allowlist
+	return p
+}
+
+// String returns the policy in Permissions-Policy header format. Features
+// are listed in the order that they were first set.
+func (p *PermissionsPolicy) String() string {
+	var parts []string
+	for _, feature := range p.features {
+		allowlist := p.allowlist[feature]
+		if len(allowlist) == 1 && allowlist[0] == "*" {
+			parts = append(parts, feature+"=*")
+			continue
+		}
+		items := make([]string, len(allowlist))
+		for i, s := range allowlist {
+			switch s {
+			case "self", "src", "*":
+				items[i] = s
+			default:
+				items[i] = QuoteHeaderValue(s)
+			}
+		}
+		parts = append(parts, feature+"=("+strings.Join(items, " ")+")")
+	}
+	return strings.Join(parts, ", ")
+}
+
+var referrerPolicies = map[string]bool{
+	"no-referrer":                     true,
+	"no-referrer-when-downgrade":      true,
+	"origin":                          true,
+	"origin-when-cross-origin":        true,
+	"same-origin":                     true,
+	"strict-origin":                   true,
+	"strict-origin-when-cross-origin": true,
+	"unsafe-url":                      true,
+}
+
+// SecureHeadersHandler returns a handler that adds security related headers
+// to the responses from h. Headers set by h are not replaced.
+//
+// SecureHeadersHandler panics if opts.ReferrerPolicy is not a valid policy.
+func SecureHeadersHandler(opts SecureHeadersOptions, h Handler) Handler {
+	if opts.ReferrerPolicy != "" && !referrerPolicies[opts.ReferrerPolicy] {
+		panic("twister: invalid referrer policy " + opts.ReferrerPolicy)
+	}
+	var kvs [][2]string
+	if opts.NoSniff {
+		kvs = append(kvs, [2]string{HeaderXContentTypeOptions, "nosniff"})
+	}
+	if opts.FrameOptions != "" {
+		kvs = append(kvs, [2]string{HeaderXFrameOptions, opts.FrameOptions})
+	}
+	if opts.ReferrerPolicy != "" {
+		kvs = append(kvs, [2]string{HeaderReferrerPolicy, opts.ReferrerPolicy})
+	}
+	if opts.PermissionsPolicy != nil {
+		if s := opts.PermissionsPolicy.String(); s != "" {
+			kvs = append(kvs, [2]string{HeaderPermissionsPolicy, s})
+		}
+	}
+	return &secureHeadersHandler{kvs, h}
+}
+
+type secureHeadersHandler struct {
+	kvs [][2]string
+	h   Handler
+}
+
+func (sh *secureHeadersHandler) ServeWeb(req *Request) {
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		for _, kv := range sh.kvs {
+			if _, found := header[kv[0]]; !found {
+				header.Set(kv[0], kv[1])
+			}
+		}
+		return status, header
+	})
+	sh.h.ServeWeb(req)
+}
+
+// SecureHandler returns a handler that redirects requests received over an
+// insecure connection to the same URL with the "https" scheme. Secure
+// requests and requests for the paths in exemptPaths are dispatched to h.
+// Exempt paths are useful for health checks made by load balancers over
+// plain HTTP.
+func SecureHandler(exemptPaths []string, h Handler) Handler {
+	exempt := make(map[string]bool)
+	for _, p := range exemptPaths {
+		exempt[p] = true
+	}
+	return secureHandler{exempt, h}
+}
+
+type secureHandler struct {
+	exempt map[string]bool
+	h      Handler
+}
+
+func (h secureHandler) ServeWeb(req *Request) {
+	if req.Secure || h.exempt[req.URL.Path] {
+		h.h.ServeWeb(req)
+		return
+	}
+	u := *req.URL
+	u.Scheme = "https"
+	u.Host = strings.TrimSuffix(u.Host, ":80")
+	req.Redirect(u.String(), true)
+}
+
+// HSTSHandler returns a handler that adds a Strict-Transport-Security header
+// with the given max-age in seconds to responses to secure requests. If
+// includeSubdomains is true, then the includeSubDomains directive is added to
+// the header. The header is not added to responses to insecure requests as
+// required by RFC 6797.
+func HSTSHandler(maxAge int, includeSubdomains bool, h Handler) Handler {
+	value := "max-age=" + strconv.Itoa(maxAge)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return hstsHandler{value, h}
+}
+
+type hstsHandler struct {
+	value string
+	h     Handler
+}
+
+func (h hstsHandler) ServeWeb(req *Request) {
+	if req.Secure {
+		FilterRespond(req, func(status int, header Header) (int, Header) {
+			header.Set(HeaderStrictTransportSecurity, h.value)
+			return status, header
+		})
+	}
+	h.h.ServeWeb(req)
+}
+
+// AllowedHosts returns a filter that responds with status 400 to requests for
+// hosts not in the list of allowed hosts. This protects applications that use
+// the request host to generate URLs from Host header attacks. A host pattern
+// of the form "*.example.com" matches all subdomains of example.com. Hosts are
+// compared without the port and case is ignored. To exempt a path such as a
+// health check, do not apply the filter to the handler for the path.
+func AllowedHosts(hosts []string) func(*Request, Handler) {
+	var patterns allowedHosts
+	for _, host := range hosts {
+		patterns = append(patterns, strings.ToLower(host))
+	}
+	return func(req *Request, h Handler) {
+		if !patterns.allowed(req.URL.Host) {
+			req.Error(StatusBadRequest, errors.New("twister: host not allowed"))
+			return
+		}
+		h.ServeWeb(req)
+	}
+}
+
+type allowedHosts []string
+
+func (patterns allowedHosts) allowed(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) && len(host) > len(pattern)-1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"testing"
+)
+
+func TestSecureHeadersHandler(t *testing.T) {
+	h := SecureHeadersHandler(SecureHeadersOptions{
+		NoSniff:        true,
+		ReferrerPolicy: "strict-origin-when-cross-origin",
+	}, HandlerFunc(func(req *Request) {
+		if req.Param.Get("own") != "" {
+			req.Respond(StatusOK, HeaderReferrerPolicy, "no-referrer")
+		} else {
+			req.Respond(StatusOK)
+		}
+	}))
+
+	_, header, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if v := header.Get(HeaderReferrerPolicy); v != "strict-origin-when-cross-origin" {
+		t.Errorf("Referrer-Policy=%q", v)
+	}
+	if v := header.Get(HeaderXContentTypeOptions); v != "nosniff" {
+		t.Errorf("X-Content-Type-Options=%q", v)
+	}
+	if _, found := header[HeaderXFrameOptions]; found {
+		t.Errorf("X-Frame-Options set")
+	}
+
+	_, header, _ = RunHandler("http://example.com/?own=1", "GET", nil, nil, h)
+	if v := header.Get(HeaderReferrerPolicy); v != "no-referrer" {
+		t.Errorf("handler Referrer-Policy replaced, got %q", v)
+	}
+}
+
+func TestSecureHeadersHandlerInvalidReferrerPolicy(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for invalid referrer policy")
+		}
+	}()
+	SecureHeadersHandler(SecureHeadersOptions{ReferrerPolicy: "sometimes"}, NotFoundHandler())
+}
+
+var permissionsPolicyTests = []struct {
+	policy *PermissionsPolicy
+	s      string
+}{
+	{new(PermissionsPolicy), ""},
+	{new(PermissionsPolicy).Set("geolocation").Set("camera", "self"), "geolocation=(), camera=(self)"},
+	{new(PermissionsPolicy).Set("fullscreen", "*"), "fullscreen=*"},
+	{new(PermissionsPolicy).Set("camera", "self", "https://example.com"), `camera=(self "https://example.com")`},
+	{new(PermissionsPolicy).Set("camera", "self").Set("camera"), "camera=()"},
+}
+
+func TestPermissionsPolicy(t *testing.T) {
+	for _, tt := range permissionsPolicyTests {
+		if s := tt.policy.String(); s != tt.s {
+			t.Errorf("policy=%q, want %q", s, tt.s)
+		}
+	}
+
+	h := SecureHeadersHandler(SecureHeadersOptions{
+		PermissionsPolicy: new(PermissionsPolicy).Set("geolocation").Set("camera", "self"),
+	}, HandlerFunc(func(req *Request) { req.Respond(StatusOK) }))
+	_, header, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if v := header.Get(HeaderPermissionsPolicy); v != "geolocation=(), camera=(self)" {
+		t.Errorf("Permissions-Policy=%q", v)
+	}
+}
+
+var secureHandlerTests = []struct {
+	url      string
+	status   int
+	location string
+}{
+	{"http://example.com/a?b=c", StatusMovedPermanently, "https://example.com/a?b=c"},
+	{"http://example.com:80/", StatusMovedPermanently, "https://example.com/"},
+	{"http://example.com:8080/", StatusMovedPermanently, "https://example.com:8080/"},
+	{"https://example.com/a", StatusOK, ""},
+	{"http://example.com/healthz", StatusOK, ""},
+}
+
+func TestSecureHandler(t *testing.T) {
+	h := SecureHandler([]string{"/healthz"}, HandlerFunc(func(req *Request) {
+		req.Respond(StatusOK)
+	}))
+	for _, tt := range secureHandlerTests {
+		status, header, _ := RunHandler(tt.url, "GET", nil, nil, h)
+		if status != tt.status {
+			t.Errorf("%s, status=%d, want %d", tt.url, status, tt.status)
+		}
+		if location := header.Get(HeaderLocation); location != tt.location {
+			t.Errorf("%s, location=%q, want %q", tt.url, location, tt.location)
+		}
+	}
+}
+
+var hstsTests = []struct {
+	url               string
+	includeSubdomains bool
+	value             string
+}{
+	{"https://example.com/", false, "max-age=31536000"},
+	{"https://example.com/", true, "max-age=31536000; includeSubDomains"},
+	{"http://example.com/", true, ""},
+}
+
+func TestHSTSHandler(t *testing.T) {
+	for _, tt := range hstsTests {
+		h := HSTSHandler(31536000, tt.includeSubdomains, HandlerFunc(func(req *Request) {
+			req.Respond(StatusOK)
+		}))
+		_, header, _ := RunHandler(tt.url, "GET", nil, nil, h)
+		if value := header.Get(HeaderStrictTransportSecurity); value != tt.value {
+			t.Errorf("%s, %v, Strict-Transport-Security=%q, want %q", tt.url, tt.includeSubdomains, value, tt.value)
+		}
+	}
+}
+
+var allowedHostsTests = []struct {
+	url    string
+	status int
+}{
+	{"http://example.com/", StatusOK},
+	{"http://EXAMPLE.com:8080/", StatusOK},
+	{"http://www.example.org/", StatusOK},
+	{"http://a.b.example.org/", StatusOK},
+	{"http://example.org/", StatusBadRequest},
+	{"http://evil.com/", StatusBadRequest},
+	{"http://notexample.com/", StatusBadRequest},
+	{"http://evilexample.org/", StatusBadRequest},
+}
+
+func TestAllowedHosts(t *testing.T) {
+	filter := AllowedHosts([]string{"example.com", "*.example.org"})
+	h := HandlerFunc(func(req *Request) { req.Respond(StatusOK) })
+	for _, tt := range allowedHostsTests {
+		req, resp := NewTestRequest("GET", tt.url, nil, nil)
+		filter(req, h)
+		if resp.Status() != tt.status {
+			t.Errorf("%s, status=%d, want %d", tt.url, resp.Status(), tt.status)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"sync"
+	"time"
+)
+
+// Session holds values that persist across requests from a client.
+type Session struct {
+	// Session identifier assigned by the store.
+	ID string
+
+	// Session values.
+	Values Values
+}
+
+// SessionStore loads and saves sessions.
+type SessionStore interface {
+	// Get returns the session for the request. If the request does not have a
+	// session, then Get returns a new empty session.
+	Get(req *Request) (*Session, error)
+
+	// Save saves the session. Save is called before the response headers are
+	// written.
+	Save(req *Request, s *Session) error
+}
+
+const sessionEnvKey = "twister.web.Session"
+
+// SessionHandler returns a handler that loads the request session from store
+// before calling h and saves the session when h calls Respond. Modifications
+// to the session after the call to Respond are not saved. Use the function
+// RequestSession to get the session in h.
+func SessionHandler(store SessionStore, h Handler) Handler {
+	return sessionHandler{store, h}
+}
+
+type sessionHandler struct {
+	store SessionStore
+	h     Handler
+}
+
+func (h sessionHandler) ServeWeb(req *Request) {
+	s, err := h.store.Get(req)
+	if err != nil {
+		req.Error(StatusInternalServerError, err)
+		return
+	}
+	req.Env[sessionEnvKey] = s
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		if err := h.store.Save(req, s); err != nil {
+			return StatusInternalServerError, header
+		}
+		return status, header
+	})
+	h.h.ServeWeb(req)
+}
+
+// RequestSession returns the session attached to the request by
+// SessionHandler or nil if the request does not have a session.
+func RequestSession(req *Request) *Session {
+	s, _ := req.Env[sessionEnvKey].(*Session)
+	return s
+}
+
+// memorySessionSweepInterval is the minimum time between scans of a
+// MemorySessionStore for expired sessions.
+const memorySessionSweepInterval = time.Minute
+
+// MemorySessionStore is a SessionStore that keeps session values in memory.
+// The session identifier is stored in a signed cookie. A session expires
+// maxAge after the last request that used the session, and the cookie is
+// refreshed on each such request.
+type MemorySessionStore struct {
+	secret     string
+	cookieName string
+	maxAge     time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	values     Values
+	expiration time.Time
+}
+
+// NewMemorySessionStore returns a new in-memory session store. The session
+// identifier cookie is signed with secret and expires maxAge after the last
+// request that used the session.
+func NewMemorySessionStore(secret, cookieName string, maxAge time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{
+		secret:     secret,
+		cookieName: cookieName,
+		maxAge:     maxAge,
+		sessions:   make(map[string]*memorySession),
+	}
+}
+
+func newSessionID() (string, error) {
+	return randToken(16)
+}
+
+// setCookie sets the session identifier cookie in the response.
+func (store *MemorySessionStore) setCookie(req *Request, id string) {
+	c := NewCookie(store.cookieName, SignValue(store.secret, store.cookieName, store.maxAge, id)).MaxAge(store.maxAge).Secure(req.Secure).String()
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		header.Add(HeaderSetCookie, c)
+		return status, header
+	})
+}
+
+func (store *MemorySessionStore) Get(req *Request) (*Session, error) {
+	if id, err := VerifyValue(store.secret, store.cookieName, req.Cookie.Get(store.cookieName)); err == nil {
+		store.mu.Lock()
+		ms := store.sessions[id]
+		if ms != nil && ms.expiration.Before(nowFunc()) {
+			delete(store.sessions, id)
+			ms = nil
+		}
+		store.mu.Unlock()
+		if ms != nil {
+			s := &Session{ID: id, Values: make(Values, len(ms.values))}
+			for k, v := range ms.values {
+				s.Values[k] = append([]string(nil), v...)
+			}
+			store.setCookie(req, id)
+			return s, nil
+		}
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	store.setCookie(req, id)
+	return &Session{ID: id, Values: make(Values)}, nil
+}
+
+func (store *MemorySessionStore) Save(req *Request, s *Session) error {
+	values := make(Values, len(s.Values))
+	for k, v := range s.Values {
+		values[k] = append([]string(nil), v...)
+	}
+	now := nowFunc()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if now.Sub(store.lastSweep) >= memorySessionSweepInterval {
+		store.lastSweep = now
+		for id, ms := range store.sessions {
+			if ms.expiration.Before(now) {
+				delete(store.sessions, id)
+			}
+		}
+	}
+	store.sessions[s.ID] = &memorySession{values: values, expiration: now.Add(store.maxAge)}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCookieJar collects cookies from responses and adds them to requests.
+type testCookieJar map[string]string
+
+func (jar testCookieJar) update(header Header) {
+	for _, s := range header[HeaderSetCookie] {
+		if i := strings.IndexByte(s, ';'); i >= 0 {
+			s = s[:i]
+		}
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			jar[s[:i]] = s[i+1:]
+		}
+	}
+}
+
+func (jar testCookieJar) header() Header {
+	header := Header{}
+	for k, v := range jar {
+		header.Add(HeaderCookie, k+"="+v)
+	}
+	return header
+}
+
+func TestSessionHandler(t *testing.T) {
+	store := NewMemorySessionStore("secret", "session", time.Hour)
+	h := SessionHandler(store, HandlerFunc(func(req *Request) {
+		s := RequestSession(req)
+		if v := req.Param.Get("set"); v != "" {
+			s.Values.Set("color", v)
+		}
+		io.WriteString(req.Respond(StatusOK), s.Values.Get("color"))
+	}))
+
+	jar := testCookieJar{}
+
+	_, header, body := RunHandler("http://example.com/?set=blue", "GET", jar.header(), nil, h)
+	if string(body) != "blue" {
+		t.Errorf("first request, body=%q, want %q", body, "blue")
+	}
+	if header.Get(HeaderSetCookie) == "" {
+		t.Fatal("first request, session cookie not set")
+	}
+	jar.update(header)
+
+	_, header, body = RunHandler("http://example.com/", "GET", jar.header(), nil, h)
+	if string(body) != "blue" {
+		t.Errorf("second request, body=%q, want %q", body, "blue")
+	}
+	if header.Get(HeaderSetCookie) == "" {
+		t.Errorf("second request, session cookie not refreshed")
+	}
+
+	_, _, body = RunHandler("http://example.com/", "GET", nil, nil, h)
+	if string(body) != "" {
+		t.Errorf("request without cookie, body=%q, want %q", body, "")
+	}
+
+	_, _, body = RunHandler("http://example.com/", "GET", NewHeader(HeaderCookie, "session=forged"), nil, h)
+	if string(body) != "" {
+		t.Errorf("request with forged cookie, body=%q, want %q", body, "")
+	}
+}
+
+func TestMemorySessionStoreExpiration(t *testing.T) {
+	now := time.Unix(1300000000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	store := NewMemorySessionStore("secret", "session", time.Hour)
+	h := SessionHandler(store, HandlerFunc(func(req *Request) {
+		s := RequestSession(req)
+		if v := req.Param.Get("set"); v != "" {
+			s.Values.Set("color", v)
+		}
+		io.WriteString(req.Respond(StatusOK), s.Values.Get("color"))
+	}))
+
+	jar := testCookieJar{}
+	_, header, _ := RunHandler("http://example.com/?set=blue", "GET", jar.header(), nil, h)
+	jar.update(header)
+
+	// Requests within maxAge of the previous request extend the session.
+	for i := 0; i < 3; i++ {
+		now = now.Add(50 * time.Minute)
+		_, header, body := RunHandler("http://example.com/", "GET", jar.header(), nil, h)
+		if string(body) != "blue" {
+			t.Fatalf("request %d, body=%q, want %q", i, body, "blue")
+		}
+		jar.update(header)
+	}
+
+	// Another client's request sweeps the expired session.
+	now = now.Add(2 * time.Hour)
+	RunHandler("http://example.com/", "GET", nil, nil, h)
+	store.mu.Lock()
+	n := len(store.sessions)
+	store.mu.Unlock()
+	if n != 1 {
+		t.Errorf("sessions after sweep=%d, want 1", n)
+	}
+
+	// Sweeps are limited to one per interval. The session created above
+	// expires between the following two requests, but the second request is
+	// within the sweep interval of the first.
+	now = now.Add(time.Hour - memorySessionSweepInterval/4)
+	RunHandler("http://example.com/", "GET", nil, nil, h)
+	now = now.Add(memorySessionSweepInterval / 2)
+	RunHandler("http://example.com/", "GET", nil, nil, h)
+	store.mu.Lock()
+	n = len(store.sessions)
+	store.mu.Unlock()
+	if n != 3 {
+		t.Errorf("sessions before next sweep=%d, want 3", n)
+	}
+	// The next sweep removes the expired session and the request adds a
+	// session.
+	now = now.Add(memorySessionSweepInterval)
+	RunHandler("http://example.com/", "GET", nil, nil, h)
+	store.mu.Lock()
+	n = len(store.sessions)
+	store.mu.Unlock()
+	if n != 3 {
+		t.Errorf("sessions after next sweep=%d, want 3", n)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+// Middleware returns a handler that wraps h.
+type Middleware func(h Handler) Handler
+
+// Phase specifies the position of middleware in a Stack.
+type Phase int
+
+// Middleware phases in execution order. Middleware in PhaseRecover sees the
+// request first and middleware in PhaseHandler runs immediately before the
+// application handler.
+const (
+	PhaseRecover Phase = iota
+	PhaseLog
+	PhaseSecurity
+	PhaseAuth
+	PhaseHandler
+	numPhases
+)
+
+var phaseNames = [numPhases]string{"recover", "log", "security", "auth", "handler"}
+
+func (p Phase) String() string {
+	if p < 0 || p >= numPhases {
+		return "unknown"
+	}
+	return phaseNames[p]
+}
+
+// Stack builds a handler from middleware registered in phases. The stack
+// runs the middleware in phase order and in the order of registration within
+// a phase, regardless of the order that the phases are registered:
+//
+//  var stack web.Stack
+//  stack.Use(web.PhaseAuth, func(h web.Handler) web.Handler {
+//      return web.BasicAuthHandler("admin", check, h)
+//  })
+//  stack.Use(web.PhaseRecover, func(h web.Handler) web.Handler {
+//      return web.RecoverHandler(h, nil)
+//  })
+//  server.Run(":8080", stack.Then(router))
+//
+// The zero value of Stack is an empty stack.
+type Stack struct {
+	middleware [numPhases][]Middleware
+}
+
+// Use adds middleware to the given phase. Use returns the stack to allow
+// chaining.
+func (s *Stack) Use(phase Phase, mw Middleware) *Stack {
+	if phase < 0 || phase >= numPhases {
+		panic("twister: invalid middleware phase")
+	}
+	s.middleware[phase] = append(s.middleware[phase], mw)
+	return s
+}
+
+// Then returns a handler that runs the middleware in the stack and then h.
+// The stack stops dispatching the request to the next middleware or h after a
+// response is committed or Request.Stop is called.
+func (s *Stack) Then(h Handler) Handler {
+	for phase := numPhases - 1; phase >= 0; phase-- {
+		mws := s.middleware[phase]
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](stopGuard{h})
+		}
+	}
+	return stackHandler{h}
+}
+
+// Stop prevents a Stack from dispatching the request to the remaining
+// middleware and handler. The Stack calls Stop when the response is
+// committed. Middleware that takes ownership of the request without calling
+// Respond, for example by hijacking the connection, should call Stop.
+func (req *Request) Stop() {
+	req.Env["twister.web.Stopped"] = true
+}
+
+// Stopped returns true if Stop was called for the request.
+func (req *Request) Stopped() bool {
+	stopped, _ := req.Env["twister.web.Stopped"].(bool)
+	return stopped
+}
+
+type stackHandler struct {
+	h Handler
+}
+
+func (h stackHandler) ServeWeb(req *Request) {
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		req.Stop()
+		return status, header
+	})
+	h.h.ServeWeb(req)
+}
+
+type stopGuard struct {
+	h Handler
+}
+
+func (g stopGuard) ServeWeb(req *Request) {
+	if !req.Stopped() {
+		g.h.ServeWeb(req)
+	}
+}
+
+// When returns middleware that runs mw for requests where pred returns true.
+// Other requests are dispatched directly to the wrapped handler.
+//
+//  stack.Use(web.PhaseAuth, web.When(func(req *web.Request) bool {
+//      return strings.HasPrefix(req.URL.Path, "/api/")
+//  }, apiAuth))
+func When(pred func(*Request) bool, mw Middleware) Middleware {
+	return func(h Handler) Handler {
+		return whenHandler{pred, mw(h), h}
+	}
+}
+
+type whenHandler struct {
+	pred    func(*Request) bool
+	matched Handler
+	h       Handler
+}
+
+func (h whenHandler) ServeWeb(req *Request) {
+	if h.pred(req) {
+		h.matched.ServeWeb(req)
+	} else {
+		h.h.ServeWeb(req)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStack(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(req *Request) {
+				order = append(order, name)
+				h.ServeWeb(req)
+			})
+		}
+	}
+	var s Stack
+	s.Use(PhaseHandler, mw("handler"))
+	s.Use(PhaseAuth, mw("auth"))
+	s.Use(PhaseSecurity, mw("security1"))
+	s.Use(PhaseRecover, mw("recover"))
+	s.Use(PhaseSecurity, mw("security2")).Use(PhaseLog, mw("log"))
+	h := s.Then(HandlerFunc(func(req *Request) {
+		order = append(order, "app")
+		req.Respond(StatusOK)
+	}))
+	RunHandler("http://example.com/", "GET", nil, nil, h)
+	want := []string{"recover", "log", "security1", "security2", "auth", "handler", "app"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order=%v, want %v", order, want)
+	}
+}
+
+func TestWhen(t *testing.T) {
+	tag := func(h Handler) Handler {
+		return HandlerFunc(func(req *Request) {
+			FilterRespond(req, func(status int, header Header) (int, Header) {
+				header.Set("X-Tagged", "yes")
+				return status, header
+			})
+			h.ServeWeb(req)
+		})
+	}
+	isAPI := func(req *Request) bool { return strings.HasPrefix(req.URL.Path, "/api/") }
+	h := When(isAPI, tag)(HandlerFunc(func(req *Request) { req.Respond(StatusOK) }))
+	for _, tt := range []struct {
+		url    string
+		tagged string
+	}{
+		{"http://example.com/api/items", "yes"},
+		{"http://example.com/items", ""},
+	} {
+		_, header, _ := RunHandler(tt.url, "GET", nil, nil, h)
+		if tagged := header.Get("X-Tagged"); tagged != tt.tagged {
+			t.Errorf("%s, X-Tagged=%q, want %q", tt.url, tagged, tt.tagged)
+		}
+	}
+}
+
+func TestStackStop(t *testing.T) {
+	var ran []string
+	mw := func(name string, f func(req *Request)) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(req *Request) {
+				ran = append(ran, name)
+				f(req)
+				h.ServeWeb(req)
+			})
+		}
+	}
+	app := HandlerFunc(func(req *Request) {
+		ran = append(ran, "app")
+		req.Respond(StatusOK)
+	})
+
+	var s Stack
+	s.Use(PhaseSecurity, mw("deny", func(req *Request) {
+		if req.Param.Get("deny") != "" {
+			req.Respond(StatusForbidden)
+		}
+	}))
+	s.Use(PhaseAuth, mw("stop", func(req *Request) {
+		if req.Param.Get("stop") != "" {
+			req.Stop()
+		}
+	}))
+	s.Use(PhaseHandler, mw("last", func(req *Request) {}))
+	h := s.Then(app)
+
+	for _, tt := range []struct {
+		url    string
+		status int
+		ran    []string
+	}{
+		{"http://example.com/", StatusOK, []string{"deny", "stop", "last", "app"}},
+		{"http://example.com/?deny=1", StatusForbidden, []string{"deny"}},
+		{"http://example.com/?stop=1", 0, []string{"deny", "stop"}},
+	} {
+		ran = nil
+		req, resp := NewTestRequest("GET", tt.url, nil, nil)
+		h.ServeWeb(req)
+		if resp.Status() != tt.status {
+			t.Errorf("%s, status=%d, want %d", tt.url, resp.Status(), tt.status)
+		}
+		if !reflect.DeepEqual(ran, tt.ran) {
+			t.Errorf("%s, ran=%v, want %v", tt.url, ran, tt.ran)
+		}
+	}
+}
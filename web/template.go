@@ -0,0 +1,77 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bufio"
+	"html/template"
+	"io"
+	"log"
+)
+
+// templateContentType is the content type of rendered templates.
+const templateContentType = "text/html; charset=utf-8"
+
+// templateWriter delays the call to Respond until the first write to the
+// response body.
+type templateWriter struct {
+	req    *Request
+	status int
+	w      io.Writer
+}
+
+func (tw *templateWriter) Write(p []byte) (int, error) {
+	if tw.w == nil {
+		tw.w = tw.req.Respond(tw.status, HeaderContentType, templateContentType)
+	}
+	return tw.w.Write(p)
+}
+
+// RenderTemplate responds to the request with the result of executing the
+// template t with data.
+//
+// The template output is buffered. If the template fails before any output is
+// written to the network, then RenderTemplate responds with status 500. If the
+// template fails after output is written, then the error is logged and the
+// response is aborted if the response body implements Aborter so that the
+// server closes the connection. In both cases the error is returned to the
+// caller.
+func (req *Request) RenderTemplate(status int, t *template.Template, data interface{}) error {
+	tw := &templateWriter{req: req, status: status}
+	bw := bufio.NewWriter(tw)
+	err := t.Execute(bw, data)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		if tw.w == nil {
+			req.Error(StatusInternalServerError, err)
+		} else {
+			log.Println("ERROR", req.URL, "template", t.Name(), err)
+			if a, ok := tw.w.(Aborter); ok {
+				a.Abort(err)
+			}
+		}
+		return err
+	}
+	if tw.w == nil {
+		// Empty template output.
+		tw.w = req.Respond(status, HeaderContentType, templateContentType)
+	}
+	if f, ok := tw.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
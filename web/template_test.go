@@ -0,0 +1,113 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"testing"
+)
+
+var renderTemplateTests = []struct {
+	text   string
+	data   interface{}
+	status int
+	body   string
+	err    bool
+}{
+	{
+		text:   "<p>Hello, {{.}}!</p>",
+		data:   "<gopher>",
+		status: StatusOK,
+		body:   "<p>Hello, &lt;gopher&gt;!</p>",
+	},
+	{
+		text:   "",
+		status: StatusOK,
+	},
+	{
+		// Error before output is written.
+		text:   "<p>{{.Missing}}</p>",
+		data:   "x",
+		status: StatusInternalServerError,
+		err:    true,
+	},
+	{
+		// Error after output is written.
+		text:   strings.Repeat(".", 8192) + "{{.Missing}}",
+		data:   "x",
+		status: StatusOK,
+		body:   strings.Repeat(".", 8192),
+		err:    true,
+	},
+}
+
+func TestRenderTemplate(t *testing.T) {
+	for i, tt := range renderTemplateTests {
+		tmpl := template.Must(template.New("test").Parse(tt.text))
+		var err error
+		h := HandlerFunc(func(req *Request) { err = req.RenderTemplate(StatusOK, tmpl, tt.data) })
+		status, header, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+		if status != tt.status {
+			t.Errorf("test %d, status=%d, want %d", i, status, tt.status)
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("test %d, err=%v, want error %v", i, err, tt.err)
+		}
+		if status != StatusOK {
+			continue
+		}
+		if ct := header.Get(HeaderContentType); ct != "text/html; charset=utf-8" {
+			t.Errorf("test %d, content type=%q, want %q", i, ct, "text/html; charset=utf-8")
+		}
+		if !strings.HasPrefix(string(body), tt.body) {
+			t.Errorf("test %d, body=%q, want %q", i, body, tt.body)
+		}
+	}
+}
+
+type abortWriter struct {
+	n   int
+	err error
+}
+
+func (w *abortWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+func (w *abortWriter) Abort(err error) { w.err = err }
+
+type abortResponder struct {
+	Responder
+	w *abortWriter
+}
+
+func (r abortResponder) Respond(status int, header Header) io.Writer { return r.w }
+
+func TestRenderTemplateAbort(t *testing.T) {
+	tmpl := template.Must(template.New("test").Parse(strings.Repeat(".", 8192) + "{{.Missing}}"))
+	w := &abortWriter{}
+	req, _ := NewTestRequest("GET", "http://example.com/", nil, nil)
+	req.Responder = abortResponder{req.Responder, w}
+	err := req.RenderTemplate(StatusOK, tmpl, "x")
+	if err == nil || w.err != err {
+		t.Errorf("err=%v, abort err=%v, want response aborted with the error", err, w.err)
+	}
+	if w.n == 0 {
+		t.Errorf("no output written before the error")
+	}
+}
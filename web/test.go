@@ -101,10 +101,32 @@ func (a testAddr) String() string {
 	return string(a)
 }
 
-// RunHandler runs the handler with a request created from the arguments and
-// returns the response. This function is intended to be used in tests.
-func RunHandler(urlStr string, method string, reqHeader Header, reqBody []byte, handler Handler) (status int, header Header, respBody []byte) {
-	var t testTransaction
+// TestResponse is the response to a request created with NewTestRequest.
+type TestResponse struct {
+	t *testTransaction
+}
+
+// Status returns the response status or 0 if the handler did not respond.
+func (r *TestResponse) Status() int { return r.t.status }
+
+// Header returns the response header.
+func (r *TestResponse) Header() Header { return r.t.header }
+
+// Body returns the bytes written to the response body.
+func (r *TestResponse) Body() []byte { return r.t.out.Bytes() }
+
+// NewTestRequest returns a request created from the arguments and the
+// response that captures what the handler writes to the request's responder.
+// The request is not connected to a network connection. This function is
+// intended to be used in tests:
+//
+//  req, resp := web.NewTestRequest("GET", "http://example.com/", nil, nil)
+//  myHandler.ServeWeb(req)
+//  if resp.Status() != web.StatusOK {
+//      t.Errorf("status=%d", resp.Status())
+//  }
+func NewTestRequest(method string, urlStr string, reqHeader Header, reqBody []byte) (*Request, *TestResponse) {
+	t := &testTransaction{}
 	if reqBody != nil {
 		t.in.Write(reqBody)
 	}
@@ -122,7 +144,14 @@ func RunHandler(urlStr string, method string, reqHeader Header, reqBody []byte,
 		panic(err)
 	}
 	req.Body = &t.in
-	req.Responder = testResponder{&t}
+	req.Responder = testResponder{t}
+	return req, &TestResponse{t}
+}
+
+// RunHandler runs the handler with a request created from the arguments and
+// returns the response. This function is intended to be used in tests.
+func RunHandler(urlStr string, method string, reqHeader Header, reqBody []byte, handler Handler) (status int, header Header, respBody []byte) {
+	req, resp := NewTestRequest(method, urlStr, reqHeader, reqBody)
 	handler.ServeWeb(req)
-	return t.status, t.header, t.out.Bytes()
+	return resp.Status(), resp.Header(), resp.Body()
 }
@@ -0,0 +1,45 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewTestRequest(t *testing.T) {
+	req, resp := NewTestRequest("POST", "http://example.com/echo?x=1", NewHeader(HeaderContentType, "text/plain"), []byte("ping"))
+	if req.Method != "POST" || req.URL.Path != "/echo" || req.Param.Get("x") != "1" {
+		t.Errorf("req method=%s path=%s param=%v", req.Method, req.URL.Path, req.Param)
+	}
+	if resp.Status() != 0 {
+		t.Errorf("status before respond=%d", resp.Status())
+	}
+	HandlerFunc(func(req *Request) {
+		p, _ := ioutil.ReadAll(req.Body)
+		w := req.Respond(StatusAccepted, HeaderContentType, req.Header.Get(HeaderContentType))
+		io.WriteString(w, string(p)+" pong")
+	}).ServeWeb(req)
+	if resp.Status() != StatusAccepted {
+		t.Errorf("status=%d, want %d", resp.Status(), StatusAccepted)
+	}
+	if ct := resp.Header().Get(HeaderContentType); ct != "text/plain" {
+		t.Errorf("content type=%q", ct)
+	}
+	if body := string(resp.Body()); body != "ping pong" {
+		t.Errorf("body=%q", body)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrHandlerTimeout is returned by writes, reads and Hijack in a handler
+// after the handler timed out.
+var ErrHandlerTimeout = errors.New("twister: handler timeout")
+
+// TimeoutHandler returns a handler that runs h with a time limit. If h does
+// not respond within the duration d, then the handler responds with status
+// 503. After the timeout, calls to Respond from h return a response body
+// that discards writes and returns ErrHandlerTimeout, and request body reads
+// return ErrHandlerTimeout. A request body read in progress when the timeout
+// expires delays the timeout response until the read returns. If h responds
+// before the timeout, then the handler waits for h to complete.
+//
+// The handler h runs in a separate goroutine with a copy of the request.
+// Values added to the request Env or set with SetValue by h and changes to
+// the request URL, header and parameters are copied to the original request
+// when h completes before the timeout. Panics in h are propagated to the caller
+// when h completes before the timeout.
+func TimeoutHandler(d time.Duration, h Handler) Handler {
+	return timeoutHandler{d, h}
+}
+
+type timeoutHandler struct {
+	d time.Duration
+	h Handler
+}
+
+func (th timeoutHandler) ServeWeb(req *Request) {
+	tr := &timeoutResponder{r: req.Responder}
+	tr.cond.L = &tr.mu
+	inner := *req
+	inner.Responder = tr
+	if req.Body != nil {
+		inner.Body = timeoutReader{tr, req.Body}
+	}
+	inner.Env = make(map[string]interface{}, len(req.Env))
+	for k, v := range req.Env {
+		inner.Env[k] = v
+	}
+	inner.values = make(map[Key]interface{}, len(req.values))
+	for k, v := range req.values {
+		inner.values[k] = v
+	}
+	// The goroutine running h can outlive the timeout. Copy the maps that h
+	// might modify so that h does not race with the caller.
+	u := *req.URL
+	inner.URL = &u
+	inner.Header = copyHeader(req.Header)
+	inner.Param = Values(copyHeader(Header(req.Param)))
+	inner.Cookie = Values(copyHeader(Header(req.Cookie)))
+	if req.URLParam != nil {
+		inner.URLParam = make(map[string]string, len(req.URLParam))
+		for k, v := range req.URLParam {
+			inner.URLParam[k] = v
+		}
+	}
+
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		th.h.ServeWeb(&inner)
+	}()
+
+	timer := time.NewTimer(th.d)
+	defer timer.Stop()
+	select {
+	case p := <-done:
+		th.complete(req, &inner, p)
+		return
+	case <-timer.C:
+	}
+
+	tr.mu.Lock()
+	if tr.responded {
+		tr.mu.Unlock()
+		th.complete(req, &inner, <-done)
+		return
+	}
+	tr.timedOut = true
+	for tr.reading {
+		tr.cond.Wait()
+	}
+	tr.mu.Unlock()
+	req.Error(StatusServiceUnavailable, ErrHandlerTimeout)
+}
+
+// complete copies the Env, values, URL, header and parameters from the inner
+// request to the outer request and propagates a panic from the inner handler.
+func (th timeoutHandler) complete(req *Request, inner *Request, p interface{}) {
+	req.URL = inner.URL
+	req.Header = inner.Header
+	req.Param = inner.Param
+	req.Cookie = inner.Cookie
+	req.URLParam = inner.URLParam
+	for k, v := range inner.Env {
+		req.Env[k] = v
+	}
+	for k, v := range inner.values {
+		req.SetValue(k, v)
+	}
+	if p != nil {
+		panic(p)
+	}
+}
+
+type timeoutResponder struct {
+	mu        sync.Mutex
+	cond      sync.Cond
+	r         Responder
+	responded bool
+	timedOut  bool
+	reading   bool
+}
+
+func (tr *timeoutResponder) Respond(status int, header Header) io.Writer {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.timedOut {
+		return timeoutWriter{}
+	}
+	tr.responded = true
+	return tr.r.Respond(status, header)
+}
+
+func (tr *timeoutResponder) Hijack() (net.Conn, *bufio.Reader, error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.timedOut {
+		return nil, nil, ErrHandlerTimeout
+	}
+	tr.responded = true
+	return tr.r.Hijack()
+}
+
+type timeoutWriter struct{}
+
+func (timeoutWriter) Write(p []byte) (int, error) { return 0, ErrHandlerTimeout }
+
+type timeoutReader struct {
+	tr *timeoutResponder
+	r  io.Reader
+}
+
+// Read does not hold the lock while reading so that the handler can respond
+// while another goroutine reads the body. The reading flag tells the timeout
+// path to wait for the read to return before the outer request is completed
+// because the server's request body must not be used after the handler
+// returns.
+func (r timeoutReader) Read(p []byte) (int, error) {
+	r.tr.mu.Lock()
+	if r.tr.timedOut {
+		r.tr.mu.Unlock()
+		return 0, ErrHandlerTimeout
+	}
+	r.tr.reading = true
+	r.tr.mu.Unlock()
+	n, err := r.r.Read(p)
+	r.tr.mu.Lock()
+	r.tr.reading = false
+	r.tr.cond.Broadcast()
+	r.tr.mu.Unlock()
+	return n, err
+}
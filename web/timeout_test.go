@@ -0,0 +1,100 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestTimeoutHandlerFast(t *testing.T) {
+	h := TimeoutHandler(time.Second, HandlerFunc(func(req *Request) {
+		req.Env["test.value"] = "set"
+		io.WriteString(req.Respond(StatusOK), "fast")
+	}))
+	req, resp := NewTestRequest("GET", "http://example.com/", nil, nil)
+	h.ServeWeb(req)
+	if resp.Status() != StatusOK || string(resp.Body()) != "fast" {
+		t.Errorf("status=%d body=%q, want %d %q", resp.Status(), resp.Body(), StatusOK, "fast")
+	}
+	if v, _ := req.Env["test.value"].(string); v != "set" {
+		t.Errorf("Env value=%q, want %q", v, "set")
+	}
+}
+
+func TestTimeoutHandlerSlow(t *testing.T) {
+	release := make(chan bool)
+	result := make(chan error, 1)
+	h := TimeoutHandler(10*time.Millisecond, HandlerFunc(func(req *Request) {
+		<-release
+		_, err := io.WriteString(req.Respond(StatusOK), "slow")
+		result <- err
+	}))
+	status, _, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+	close(release)
+	if status != StatusServiceUnavailable {
+		t.Errorf("status=%d, want %d", status, StatusServiceUnavailable)
+	}
+	if err := <-result; err != ErrHandlerTimeout {
+		t.Errorf("late write err=%v, want %v", err, ErrHandlerTimeout)
+	}
+	if string(body) == "slow" {
+		t.Errorf("body=%q written after timeout", body)
+	}
+}
+
+func TestTimeoutHandlerRespondBeforeTimeout(t *testing.T) {
+	h := TimeoutHandler(10*time.Millisecond, HandlerFunc(func(req *Request) {
+		w := req.Respond(StatusOK)
+		time.Sleep(30 * time.Millisecond)
+		io.WriteString(w, "streamed")
+	}))
+	status, _, body := RunHandler("http://example.com/", "GET", nil, nil, h)
+	if status != StatusOK || string(body) != "streamed" {
+		t.Errorf("status=%d body=%q, want %d %q", status, body, StatusOK, "streamed")
+	}
+}
+
+func TestTimeoutHandlerBlockedRead(t *testing.T) {
+	pr, pw := io.Pipe()
+	result := make(chan error, 1)
+	h := TimeoutHandler(10*time.Millisecond, HandlerFunc(func(req *Request) {
+		_, err := ioutil.ReadAll(req.Body)
+		req.Param.Set("late", "1")
+		req.Header.Set("X-Late", "1")
+		result <- err
+	}))
+	req, resp := NewTestRequest("POST", "http://example.com/", nil, nil)
+	req.Body = pr
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pw.Write([]byte("body"))
+	}()
+	h.ServeWeb(req)
+	if resp.Status() != StatusServiceUnavailable {
+		t.Errorf("status=%d, want %d", resp.Status(), StatusServiceUnavailable)
+	}
+	// The read in progress at the timeout completes before ServeWeb returns
+	// and later reads fail without touching the body.
+	pw.Close()
+	if err := <-result; err != ErrHandlerTimeout {
+		t.Errorf("read err=%v, want %v", err, ErrHandlerTimeout)
+	}
+	if req.Param.Get("late") != "" || req.Header.Get("X-Late") != "" {
+		t.Errorf("late handler modified the request, param=%v header=%v", req.Param, req.Header)
+	}
+}
@@ -53,6 +53,19 @@ func (m Values) Set(key string, value string) {
 	m[key] = []string{value}
 }
 
+// Delete removes the values for the given key. Delete does nothing if the key
+// is not present.
+func (m Values) Delete(key string) {
+	delete(m, key)
+}
+
+// Clear removes all keys from the map.
+func (m Values) Clear() {
+	for key := range m {
+		delete(m, key)
+	}
+}
+
 // StringMap returns a string to string map by discarding all but the first
 // value for a key. 
 func (m Values) StringMap() map[string]string {
@@ -105,20 +118,39 @@ func dehex(c byte) byte {
 }
 
 // ParseFormEncodedBytes parses the URL-encoded form and appends the values to
-// the supplied map. This function modifies the contents of p.
+// the supplied map. A key without a value, as in "a&b=c", is added with the
+// value "". Values with an empty key are ignored. This function modifies the
+// contents of p.
 func (m Values) ParseFormEncodedBytes(p []byte) error {
 	key := ""
+	hasKey := false
 	j := 0
+	add := func() {
+		if hasKey {
+			if key != "" {
+				m.Add(key, string(p[0:j]))
+			}
+		} else if j > 0 {
+			m.Add(string(p[0:j]), "")
+		}
+		key = ""
+		hasKey = false
+		j = 0
+	}
 	for i := 0; i < len(p); {
 		switch p[i] {
 		case '=':
-			key = string(p[0:j])
-			j = 0
+			if hasKey {
+				p[j] = p[i]
+				j += 1
+			} else {
+				key = string(p[0:j])
+				hasKey = true
+				j = 0
+			}
 			i += 1
 		case '&':
-			m.Add(key, string(p[0:j]))
-			key = ""
-			j = 0
+			add()
 			i += 1
 		case '%':
 			if i+2 >= len(p) {
@@ -142,8 +174,6 @@ func (m Values) ParseFormEncodedBytes(p []byte) error {
 			i += 1
 		}
 	}
-	if key != "" {
-		m.Add(key, string(p[0:j]))
-	}
+	add()
 	return nil
 }
@@ -30,6 +30,11 @@ var ParseUrlEncodedFormTests = []ParseUrlEncodedFormTest{
 	{"a=b&c=d", Values{"a": []string{"b"}, "c": []string{"d"}}},
 	{"a=b&a=c", Values{"a": []string{"b", "c"}}},
 	{"a=Hello%20World", Values{"a": []string{"Hello World"}}},
+	{"a", Values{"a": []string{""}}},
+	{"a&b=c&a", Values{"a": []string{"", ""}, "b": []string{"c"}}},
+	{"a=b=c", Values{"a": []string{"b=c"}}},
+	{"a=1&&a=2", Values{"a": []string{"1", "2"}}},
+	{"=x&a=1", Values{"a": []string{"1"}}},
 }
 
 func TestParseUrlEncodedForm(t *testing.T) {
@@ -42,3 +47,90 @@ func TestParseUrlEncodedForm(t *testing.T) {
 		}
 	}
 }
+
+func TestRequestQueryParam(t *testing.T) {
+	h := NewRouter().Register("/<id>", "GET", func(req *Request) {
+		expected := Values{"a": {"1", "2"}, "flag": {""}, "id": {"q"}}
+		if !reflect.DeepEqual(req.Param, expected) {
+			t.Errorf("param=%v, want %v", req.Param, expected)
+		}
+		if id := req.URLParam["id"]; id != "7" {
+			t.Errorf("url param id=%q, want 7", id)
+		}
+		req.Respond(StatusOK)
+	})
+	if status, _, _ := RunHandler("http://example.com/7?a=1&flag&a=2&id=q", "GET", nil, nil, h); status != StatusOK {
+		t.Errorf("status=%d, want %d", status, StatusOK)
+	}
+}
+
+// roundTrip encodes m and parses the encoded form.
+func roundTrip(m Values) (Values, error) {
+	result := make(Values)
+	err := result.ParseFormEncodedBytes(m.FormEncodedBytes())
+	return result, err
+}
+
+var roundTripTests = []string{
+	"a=1",
+	"a=1&a=2&b=3",
+	"a=",
+	"a",
+	"a+b=c+d",
+	"a%2Bb=c%2Bd",
+	"sp%20ace=%20lead%20and%20trail%20",
+	"amp%26=eq%3D&q%3F=hash%23",
+	"pct%25=%2525",
+	"slash=%2F..%2F&colon=%3A%3B",
+	"uni%C3%A9=%E2%9C%93",
+	"ctl=%00%0D%0A%09",
+	"empty=&empty=&empty=x",
+}
+
+func TestFormEncodedRoundTrip(t *testing.T) {
+	for _, s := range roundTripTests {
+		m := make(Values)
+		if err := m.ParseFormEncodedBytes([]byte(s)); err != nil {
+			t.Errorf("parse %q, %v", s, err)
+			continue
+		}
+		actual, err := roundTrip(m)
+		if err != nil {
+			t.Errorf("round trip %q, encoded %q, %v", s, m.FormEncodedString(), err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, m) {
+			t.Errorf("round trip %q, encoded %q, got %q, want %q", s, m.FormEncodedString(), actual, m)
+		}
+	}
+
+	// Values constructed directly, including bytes that need escaping.
+	var b []byte
+	for i := 0; i < 256; i++ {
+		b = append(b, byte(i))
+	}
+	m := NewValues("all", string(b), "all", "", "+ &=%?#", "multiple\nlines")
+	actual, err := roundTrip(m)
+	if err != nil || !reflect.DeepEqual(actual, m) {
+		t.Errorf("round trip, got %q, %v, want %q", actual, err, m)
+	}
+}
+
+func TestValuesDelete(t *testing.T) {
+	m := NewValues("a", "1", "a", "2", "b", "3")
+	m.Delete("a")
+	if v := m.Get("a"); v != "" {
+		t.Errorf("Get(a) after delete = %q", v)
+	}
+	if _, found := m["a"]; found {
+		t.Errorf("key a present after delete")
+	}
+	if v := m.Get("b"); v != "3" {
+		t.Errorf("Get(b) = %q, want 3", v)
+	}
+	m.Delete("missing")
+	m.Clear()
+	if len(m) != 0 {
+		t.Errorf("len after clear = %d", len(m))
+	}
+}
@@ -25,7 +25,6 @@ import (
 	"math"
 	"net"
 	"net/url"
-	"path"
 	"strconv"
 	"strings"
 )
@@ -66,6 +65,12 @@ type Request struct {
 	// The request URL with host and scheme set appropriately.
 	URL *url.URL
 
+	// True if the request was received over a secure connection. NewRequest
+	// sets this field when the URL scheme is "https". Use
+	// ForwardedProtoHandler to set this field from the X-Forwarded-Proto
+	// header set by a trusted proxy.
+	Secure bool
+
 	// The IP address of the client sending the request to the server.
 	RemoteAddr string
 
@@ -100,6 +105,45 @@ type Request struct {
 
 	// Attributes attached to the request by middleware. 
 	Env map[string]interface{}
+
+	// Values set with SetValue.
+	values map[Key]interface{}
+}
+
+// Key is a key for request-scoped values set with SetValue. Keys created by
+// different calls to NewKey are distinct, so packages that keep their keys
+// private do not collide with each other.
+type Key struct {
+	k *keyName
+}
+
+type keyName struct {
+	name string
+}
+
+// NewKey returns a new key. The name is used for debugging only.
+func NewKey(name string) Key {
+	return Key{&keyName{name}}
+}
+
+// String returns the name of the key.
+func (k Key) String() string {
+	return k.k.name
+}
+
+// SetValue sets the request-scoped value for key. Use the Env map for
+// attributes that do not need protection from collisions.
+func (req *Request) SetValue(key Key, v interface{}) {
+	if req.values == nil {
+		req.values = make(map[Key]interface{})
+	}
+	req.values[key] = v
+}
+
+// Value returns the request-scoped value for key or nil if the value is not
+// set.
+func (req *Request) Value(key Key) interface{} {
+	return req.values[key]
 }
 
 // ErrorHandler handles request errors.
@@ -127,6 +171,7 @@ func NewRequest(remoteAddr string, method string, requestURI string, protocolVer
 		RequestURI:      requestURI,
 		ProtocolVersion: protocolVersion,
 		URL:             u,
+		Secure:          u.Scheme == "https",
 		ErrorHandler:    defaultErrorHandler,
 		Param:           make(Values),
 		Header:          header,
@@ -158,6 +203,20 @@ func NewRequest(remoteAddr string, method string, requestURI string, protocolVer
 	return req, nil
 }
 
+// Set adds the attribute v to the request Env with the given key. Use a
+// package-qualified key such as "twister.web.Session" to avoid collisions
+// between middleware.
+func (req *Request) Set(key string, v interface{}) {
+	req.Env[key] = v
+}
+
+// GetEnv returns the request Env attribute with the given key and true if
+// the attribute is present.
+func (req *Request) GetEnv(key string) (interface{}, bool) {
+	v, ok := req.Env[key]
+	return v, ok
+}
+
 // Respond is a convenience function that adds (key, value) pairs in
 // headerKeysAndValues to a Header and calls through to the responder's
 // Respond method.
@@ -165,10 +224,53 @@ func (req *Request) Respond(status int, headerKeysAndValues ...string) io.Writer
 	return req.Responder.Respond(status, NewHeader(headerKeysAndValues...))
 }
 
+// SendContinue sends the 100 Continue interim response to a client waiting
+// for permission to send the request body. The server sends the interim
+// response automatically on the first read from the request body.
+// SendContinue is useful for sending the response before the application is
+// ready to read the body. SendContinue does nothing if the request does not
+// have an "Expect: 100-continue" header, the interim response was already
+// sent or the request body does not implement ContinueSender.
+func (req *Request) SendContinue() error {
+	if cs, ok := req.Body.(ContinueSender); ok {
+		return cs.SendContinue()
+	}
+	return nil
+}
+
+// SetKeepAlive controls whether the connection is kept open after the
+// response. If keepAlive is false, then the response has a "Connection:
+// close" header and the server closes the connection after writing the
+// response. Call SetKeepAlive before calling Respond. Setting keepAlive to true
+// cancels an earlier call with false; it does not keep the connection open
+// when the server closes the connection for other reasons, such as an
+// HTTP/1.0 request without "Connection: keep-alive".
+func (req *Request) SetKeepAlive(keepAlive bool) {
+	_, installed := req.Env["twister.web.KeepAlive"]
+	req.Env["twister.web.KeepAlive"] = keepAlive
+	if installed {
+		return
+	}
+	FilterRespond(req, func(status int, header Header) (int, Header) {
+		if keepAlive, _ := req.Env["twister.web.KeepAlive"].(bool); !keepAlive {
+			header.Set(HeaderConnection, "close")
+		}
+		return status, header
+	})
+}
+
 func defaultErrorHandler(req *Request, status int, reason error, header Header) {
+	if e, ok := reason.(*HTTPError); ok && e.Status == status {
+		respondHTTPError(req, e, header)
+		return
+	}
 	header.Set(HeaderContentType, "text/plain; charset=utf-8")
 	w := req.Responder.Respond(status, header)
-	io.WriteString(w, StatusText(status))
+	text := StatusText(status)
+	if text == "" {
+		text = "Status " + strconv.Itoa(status)
+	}
+	io.WriteString(w, text)
 	if reason != nil || status >= 500 {
 		log.Println("ERROR", req.URL, status, reason)
 	}
@@ -179,18 +281,33 @@ func (req *Request) Error(status int, reason error, headerKeysAndValues ...strin
 	req.ErrorHandler(req, status, reason, NewHeader(headerKeysAndValues...))
 }
 
-// Redirect responds to the request with a redirect to the specified URL.
+// Redirect responds to the request with a redirect to the specified URL. A
+// relative URL path is resolved against the request URL path.
 func (req *Request) Redirect(urlStr string, perm bool, headerKeysAndValues ...string) {
 	status := StatusFound
 	if perm {
 		status = StatusMovedPermanently
 	}
+	req.redirect(status, urlStr, headerKeysAndValues)
+}
+
+// RedirectPreserve responds to the request with a redirect to the specified
+// URL using status 307 or status 308 if perm is true. Unlike the 301 and 302
+// responses sent by Redirect, these responses require the client to repeat
+// the request with the same method and body at the new URL. Use this method
+// to redirect POST and other requests with bodies.
+func (req *Request) RedirectPreserve(urlStr string, perm bool, headerKeysAndValues ...string) {
+	status := StatusTemporaryRedirect
+	if perm {
+		status = StatusPermanentRedirect
+	}
+	req.redirect(status, urlStr, headerKeysAndValues)
+}
 
-	// Make relative path absolute
-	u, err := url.Parse(urlStr)
-	if err != nil && u.Scheme == "" && urlStr[0] != '/' {
-		d, _ := path.Split(req.URL.Path)
-		urlStr = d + urlStr
+func (req *Request) redirect(status int, urlStr string, headerKeysAndValues []string) {
+	// Resolve relative path against the request path.
+	if u, err := url.Parse(urlStr); err == nil && u.Scheme == "" && u.Host == "" && !strings.HasPrefix(u.Path, "/") {
+		urlStr = (&url.URL{Path: req.URL.Path}).ResolveReference(u).String()
 	}
 
 	header := NewHeader(headerKeysAndValues...)
@@ -198,6 +315,119 @@ func (req *Request) Redirect(urlStr string, perm bool, headerKeysAndValues ...st
 	req.Responder.Respond(status, header)
 }
 
+// AbsoluteURL returns an absolute URL for urlStr. The scheme is taken from
+// the request URL. Use ForwardedProtoHandler to set the scheme from the
+// X-Forwarded-Proto header sent by a trusted proxy. The host is taken from
+// the request URL with the default port for the scheme omitted. A relative
+// path is resolved against the request URL path. The base path set by
+// BasePathHandler is prepended to an absolute path. If urlStr is already an
+// absolute URL, then it is returned unchanged.
+func (req *Request) AbsoluteURL(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return urlStr
+	}
+	if strings.HasPrefix(u.Path, "/") {
+		u.Path = req.ExternalPath(u.Path)
+	} else {
+		u = (&url.URL{Path: req.URL.Path}).ResolveReference(u)
+	}
+	scheme := req.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	host := req.URL.Host
+	if (scheme == "http" && strings.HasSuffix(host, ":80")) || (scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndex(host, ":")]
+	}
+	u.Scheme = scheme
+	u.Host = host
+	return u.String()
+}
+
+// ClientIP returns the IP address of the client. If the request was received
+// from one of the trusted proxies, then the X-Forwarded-For header is walked
+// from right to left and the first address that is not a trusted proxy is
+// returned. Trusted proxies are specified as IP addresses or CIDR ranges. The
+// address of the peer is returned when the peer is not a trusted proxy or the
+// request does not have an X-Forwarded-For header.
+func (req *Request) ClientIP(trustedProxies ...string) string {
+	ip := remoteIP(req.RemoteAddr)
+	if !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+	hops := req.Header.GetList(HeaderXForwardedFor)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := remoteIP(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(ip, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+// isTrustedProxy returns true if ip matches one of the addresses or CIDR
+// ranges in trustedProxies.
+func isTrustedProxy(ip string, trustedProxies []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range trustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, n, err := net.ParseCIDR(proxy); err == nil && n.Contains(parsed) {
+				return true
+			}
+		} else if p := net.ParseIP(proxy); p != nil && p.Equal(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedirectWithQuery responds to the request with a redirect to the specified
+// URL with the request query string added to the URL. If the URL has a query
+// string, then the request parameters are merged into the URL's query string.
+// Parameters in the URL take precedence over request parameters with the same
+// name.
+func (req *Request) RedirectWithQuery(urlStr string, perm bool, headerKeysAndValues ...string) {
+	req.Redirect(mergeQuery(urlStr, req.URL.RawQuery), perm, headerKeysAndValues...)
+}
+
+// mergeQuery adds the parameters in rawQuery to urlStr. Parameters in rawQuery
+// with the same name as a parameter in urlStr are dropped.
+func mergeQuery(urlStr string, rawQuery string) string {
+	s := urlStr
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		s = s[:i]
+	}
+	i := strings.IndexByte(s, '?')
+	if i < 0 {
+		return appendQuery(urlStr, rawQuery)
+	}
+	target := make(Values)
+	if err := target.ParseFormEncodedBytes([]byte(s[i+1:])); err != nil {
+		return urlStr
+	}
+	var keep []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		m := make(Values)
+		if m.ParseFormEncodedBytes([]byte(pair)) != nil || len(m) == 0 {
+			continue
+		}
+		for k := range m {
+			if _, found := target[k]; !found {
+				keep = append(keep, pair)
+			}
+		}
+	}
+	return appendQuery(urlStr, strings.Join(keep, "&"))
+}
+
 // BodyBytes returns the request body a slice of bytes. If maxLen is negative,
 // then no limit is imposed on the length of the body. If the body is longer
 // than maxLen, then ErrRequestEntityTooLarge is returned.
@@ -230,18 +460,83 @@ func (req *Request) BodyBytes(maxLen int) ([]byte, error) {
 	return p, nil
 }
 
+// CopyBody copies the request body to w and returns the number of bytes
+// copied. If maxLen is negative, then no limit is imposed on the length of
+// the body. If the body is longer than maxLen, then CopyBody copies maxLen
+// bytes and returns ErrRequestEntityTooLarge. If the request ContentLength is
+// greater than maxLen, then CopyBody returns ErrRequestEntityTooLarge without
+// reading the body.
+func (req *Request) CopyBody(w io.Writer, maxLen int) (int, error) {
+	if maxLen < 0 {
+		n, err := io.Copy(w, req.Body)
+		return int(n), err
+	}
+	if req.ContentLength > maxLen {
+		return 0, ErrRequestEntityTooLarge
+	}
+	n, err := io.CopyN(w, req.Body, int64(maxLen))
+	if err == io.EOF {
+		return int(n), nil
+	} else if err != nil {
+		return int(n), err
+	}
+	var p [1]byte
+	if m, _ := io.ReadFull(req.Body, p[:]); m > 0 {
+		return int(n), ErrRequestEntityTooLarge
+	}
+	return int(n), nil
+}
+
+// PeekBody returns up to the first n bytes of the request body without
+// consuming them. The bytes are returned by later reads from the request
+// body. PeekBody returns fewer than n bytes if the body is shorter than n
+// bytes.
+func (req *Request) PeekBody(n int) ([]byte, error) {
+	pb, ok := req.Body.(*peekedBody)
+	if !ok {
+		pb = &peekedBody{r: req.Body}
+		req.Body = pb
+	}
+	if len(pb.buf) < n {
+		p := make([]byte, n-len(pb.buf))
+		m, err := io.ReadFull(pb.r, p)
+		pb.buf = append(pb.buf, p[:m]...)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+	}
+	if len(pb.buf) < n {
+		n = len(pb.buf)
+	}
+	return pb.buf[:n], nil
+}
+
+// peekedBody is a request body with bytes read by PeekBody.
+type peekedBody struct {
+	buf []byte
+	r   io.Reader
+}
+
+func (pb *peekedBody) Read(p []byte) (int, error) {
+	if len(pb.buf) > 0 {
+		n := copy(p, pb.buf)
+		pb.buf = pb.buf[n:]
+		return n, nil
+	}
+	return pb.r.Read(p)
+}
+
 // ParseForm parses url-encoded form bodies. ParseForm is idempotent. Most
 // applications should use the FormHandler middleware instead of calling this
 // method directly.
 func (req *Request) ParseForm(maxRequestBodyLen int) error {
-	const key = "twister.web.formParsed"
-	if req.Env[key] != nil ||
+	if req.Env[bodyParsedEnvKey] != nil ||
 		req.ContentType != "application/x-www-form-urlencoded" ||
 		req.ContentLength == 0 ||
-		(req.Method != "POST" && req.Method != "PUT") {
+		(req.Method != "POST" && req.Method != "PUT" && req.Method != "PATCH") {
 		return nil
 	}
-	req.Env[key] = true
+	req.Env[bodyParsedEnvKey] = true
 	p, err := req.BodyBytes(maxRequestBodyLen)
 	if err != nil {
 		return err
@@ -252,9 +547,58 @@ func (req *Request) ParseForm(maxRequestBodyLen int) error {
 	return nil
 }
 
+// formValueBodyLen is the maximum length of the request body parsed by
+// FormValue and FormValues.
+const formValueBodyLen = 1 << 20
+
+// FormValue returns the first value for the named parameter from the URL
+// query or url-encoded form body. FormValue parses the form body with
+// ParseForm if it was not already parsed. Errors reading or parsing the body
+// are ignored; use FormHandler or ParseForm to handle these errors.
+func (req *Request) FormValue(key string) string {
+	req.ParseForm(formValueBodyLen)
+	return req.Param.Get(key)
+}
+
+// FormValues returns all values for the named parameter from the URL query
+// or url-encoded form body. See FormValue for details on form parsing.
+func (req *Request) FormValues(key string) []string {
+	req.ParseForm(formValueBodyLen)
+	return req.Param[key]
+}
+
 // Flusher is implemented by response bodies that allow the HTTP handler to
 // flush buffered data to the network. Flush data to the network is useful for
 // implementing long polling and other Comet mechanisms. 
 type Flusher interface {
 	Flush() error
 }
+
+// TrailerSetter is implemented by response bodies that support HTTP
+// trailers. The trailer fields are sent after the response body. The
+// application should declare the trailer fields in the Trailer response
+// header. Trailers are only supported for chunked responses, that is
+// responses without a Content-Length header to HTTP/1.1 clients.
+type TrailerSetter interface {
+	SetTrailer(key, value string)
+}
+
+// Aborter is implemented by response bodies that can abort the response.
+// After a call to Abort, writes to the response body return err, buffered
+// data is discarded and the server closes the connection without completing
+// the response.
+type Aborter interface {
+	Abort(err error)
+}
+
+// ContinueSender is implemented by request bodies that can send the 100
+// Continue interim response.
+type ContinueSender interface {
+	SendContinue() error
+}
+
+// EarlyHintsSender is implemented by request bodies that can send the 103
+// Early Hints interim response.
+type EarlyHintsSender interface {
+	SendEarlyHints(header Header) error
+}
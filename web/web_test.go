@@ -0,0 +1,358 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRequestEnv(t *testing.T) {
+	outer := func(h Handler) Handler {
+		return HandlerFunc(func(req *Request) {
+			req.Set("test.user", "gopher")
+			h.ServeWeb(req)
+		})
+	}
+	inner := HandlerFunc(func(req *Request) {
+		w := req.Respond(StatusOK)
+		if v, ok := req.GetEnv("test.user"); ok {
+			io.WriteString(w, v.(string))
+		}
+		if _, ok := req.GetEnv("test.missing"); ok {
+			io.WriteString(w, " missing")
+		}
+	})
+	_, _, body := RunHandler("http://example.com/", "GET", nil, nil, outer(inner))
+	if string(body) != "gopher" {
+		t.Errorf("body=%q, want %q", body, "gopher")
+	}
+}
+
+var redirectWithQueryTests = []struct {
+	url      string
+	target   string
+	location string
+}{
+	{"http://example.com/", "/login", "/login"},
+	{"http://example.com/?next=/a", "/login", "/login?next=/a"},
+	{"http://example.com/?next=/a&x=1", "/login?x=2", "/login?x=2&next=/a"},
+	{"http://example.com/?next=/a", "/login?b=1#top", "/login?b=1&next=/a#top"},
+	{"http://example.com/?next=/a", "/login#top", "/login?next=/a#top"},
+	{"http://example.com/?next=%2Fa", "/login?", "/login?next=%2Fa"},
+}
+
+func TestRedirectWithQuery(t *testing.T) {
+	for _, tt := range redirectWithQueryTests {
+		h := HandlerFunc(func(req *Request) { req.RedirectWithQuery(tt.target, false) })
+		status, header, _ := RunHandler(tt.url, "GET", nil, nil, h)
+		if status != StatusFound {
+			t.Errorf("%s %s, status=%d, want %d", tt.url, tt.target, status, StatusFound)
+		}
+		if location := header.Get(HeaderLocation); location != tt.location {
+			t.Errorf("%s %s, location=%q, want %q", tt.url, tt.target, location, tt.location)
+		}
+	}
+}
+
+var redirectTests = []struct {
+	target   string
+	location string
+}{
+	{"../foo", "/a/foo"},
+	{"foo", "/a/b/foo"},
+	{"foo/", "/a/b/foo/"},
+	{"./foo?x=1#top", "/a/b/foo?x=1#top"},
+	{"../../../foo", "/foo"},
+	{"/abs", "/abs"},
+	{"http://other/", "http://other/"},
+	{"//other/x", "//other/x"},
+}
+
+func TestRedirect(t *testing.T) {
+	for _, tt := range redirectTests {
+		h := HandlerFunc(func(req *Request) { req.Redirect(tt.target, true) })
+		status, header, _ := RunHandler("http://example.com/a/b/c", "GET", nil, nil, h)
+		if status != StatusMovedPermanently {
+			t.Errorf("%s, status=%d, want %d", tt.target, status, StatusMovedPermanently)
+		}
+		if location := header.Get(HeaderLocation); location != tt.location {
+			t.Errorf("%s, location=%q, want %q", tt.target, location, tt.location)
+		}
+	}
+}
+
+var absoluteURLTests = []struct {
+	url      string
+	header   Header
+	target   string
+	expected string
+}{
+	{"http://example.com/a/b", nil, "/x", "http://example.com/x"},
+	{"http://example.com:80/a/b", nil, "/x?y=1", "http://example.com/x?y=1"},
+	{"http://example.com:8080/a/b", nil, "c", "http://example.com:8080/a/c"},
+	{"https://example.com:443/a/b", nil, "/x", "https://example.com/x"},
+	{"https://example.com:80/a/b", nil, "/x", "https://example.com:80/x"},
+	{"http://example.com:443/", NewHeader(HeaderXForwardedProto, "https"), "/x", "http://example.com:443/x"},
+	{"http://example.com/", NewHeader(HeaderXForwardedProto, "bogus"), "/x", "http://example.com/x"},
+	{"http://example.com/", nil, "https://other/x", "https://other/x"},
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	for _, tt := range absoluteURLTests {
+		var actual string
+		h := HandlerFunc(func(req *Request) {
+			actual = req.AbsoluteURL(tt.target)
+			req.Respond(StatusOK)
+		})
+		RunHandler(tt.url, "GET", tt.header, nil, h)
+		if actual != tt.expected {
+			t.Errorf("%s %v AbsoluteURL(%q) = %q, want %q", tt.url, tt.header, tt.target, actual, tt.expected)
+		}
+	}
+
+	// X-Forwarded-Proto from a trusted proxy.
+	var actual string
+	fh := ForwardedProtoHandler([]string{"1.2.3.4"}, HandlerFunc(func(req *Request) {
+		actual = req.AbsoluteURL("/x")
+		req.Respond(StatusOK)
+	}))
+	RunHandler("http://example.com:443/", "GET", NewHeader(HeaderXForwardedProto, "https"), nil, fh)
+	if actual != "https://example.com/x" {
+		t.Errorf("trusted proxy AbsoluteURL(/x) = %q, want %q", actual, "https://example.com/x")
+	}
+
+	h := BasePathHandler("/service1", AbsoluteRedirectHandler(HandlerFunc(func(req *Request) {
+		req.Redirect("/login", false)
+	})))
+	_, header, _ := RunHandler("https://example.com/service1/a", "GET", nil, nil, h)
+	if location := header.Get(HeaderLocation); location != "https://example.com/service1/login" {
+		t.Errorf("location=%q, want https://example.com/service1/login", location)
+	}
+}
+
+func TestRedirectPreserve(t *testing.T) {
+	for _, perm := range []bool{false, true} {
+		h := HandlerFunc(func(req *Request) { req.RedirectPreserve("/v2/items", perm) })
+		status, header, _ := RunHandler("http://example.com/v1/items", "POST", nil, []byte("a=1"), h)
+		expected := StatusTemporaryRedirect
+		if perm {
+			expected = StatusPermanentRedirect
+		}
+		if status != expected {
+			t.Errorf("perm=%v, status=%d, want %d", perm, status, expected)
+		}
+		if location := header.Get(HeaderLocation); location != "/v2/items" {
+			t.Errorf("perm=%v, location=%q, want /v2/items", perm, location)
+		}
+	}
+}
+
+var requestContentTypeTests = []struct {
+	s           string
+	contentType string
+	param       map[string]string
+}{
+	{"", "", map[string]string{}},
+	{"text/html; charset=utf-8", "text/html", map[string]string{"charset": "utf-8"}},
+	{"Text/HTML ;  Charset=\"UTF-8\" ", "text/html", map[string]string{"charset": "UTF-8"}},
+	{`multipart/form-data; boundary="----a; b"`, "multipart/form-data", map[string]string{"boundary": "----a; b"}},
+	{"multipart/form-data;boundary=xyz", "multipart/form-data", map[string]string{"boundary": "xyz"}},
+}
+
+func TestRequestContentType(t *testing.T) {
+	for _, tt := range requestContentTypeTests {
+		header := NewHeader()
+		if tt.s != "" {
+			header.Set(HeaderContentType, tt.s)
+		}
+		req, _ := NewTestRequest("POST", "http://example.com/", header, nil)
+		if req.ContentType != tt.contentType {
+			t.Errorf("%q, ContentType=%q, want %q", tt.s, req.ContentType, tt.contentType)
+		}
+		if !reflect.DeepEqual(req.ContentParam, tt.param) {
+			t.Errorf("%q, ContentParam=%v, want %v", tt.s, req.ContentParam, tt.param)
+		}
+	}
+}
+
+var clientIPTests = []struct {
+	remoteAddr string
+	forwarded  string
+	trusted    []string
+	ip         string
+}{
+	{"1.2.3.4:5678", "", nil, "1.2.3.4"},
+	{"1.2.3.4:5678", "9.9.9.9", nil, "1.2.3.4"},
+	{"10.0.0.1:5678", "", []string{"10.0.0.1"}, "10.0.0.1"},
+	{"10.0.0.1:5678", "5.6.7.8", []string{"10.0.0.1"}, "5.6.7.8"},
+	{"10.0.0.2:5678", "6.6.6.6, 5.6.7.8, 10.0.0.1", []string{"10.0.0.0/8"}, "5.6.7.8"},
+	{"10.0.0.2:5678", "6.6.6.6, 5.6.7.8, 10.0.0.9", []string{"10.0.0.1", "10.0.0.2"}, "10.0.0.9"},
+	{"10.0.0.2:5678", "10.0.0.3, 10.0.0.1", []string{"10.0.0.0/8"}, "10.0.0.3"},
+	{"10.0.0.2:5678", "garbage, 5.6.7.8", []string{"10.0.0.0/8"}, "5.6.7.8"},
+	{"10.0.0.2:5678", "5.6.7.8, garbage", []string{"10.0.0.0/8"}, "10.0.0.2"},
+	{"[::1]:5678", "2001:db8::1", []string{"::1"}, "2001:db8::1"},
+}
+
+func TestClientIP(t *testing.T) {
+	for _, tt := range clientIPTests {
+		header := NewHeader()
+		if tt.forwarded != "" {
+			header.Set(HeaderXForwardedFor, tt.forwarded)
+		}
+		req := &Request{RemoteAddr: tt.remoteAddr, Header: header}
+		if ip := req.ClientIP(tt.trusted...); ip != tt.ip {
+			t.Errorf("ClientIP(%v) with remote %s and X-Forwarded-For %q = %s, want %s",
+				tt.trusted, tt.remoteAddr, tt.forwarded, ip, tt.ip)
+		}
+	}
+}
+
+func TestSetKeepAlive(t *testing.T) {
+	for _, calls := range [][]bool{{}, {false}, {true}, {false, true}, {true, false}} {
+		h := HandlerFunc(func(req *Request) {
+			for _, keepAlive := range calls {
+				req.SetKeepAlive(keepAlive)
+			}
+			req.Respond(StatusOK)
+		})
+		_, header, _ := RunHandler("http://example.com/", "GET", nil, nil, h)
+		want := ""
+		if len(calls) > 0 && !calls[len(calls)-1] {
+			want = "close"
+		}
+		if c := header.Get(HeaderConnection); c != want {
+			t.Errorf("SetKeepAlive calls %v, Connection=%q, want %q", calls, c, want)
+		}
+	}
+}
+
+func TestPeekBody(t *testing.T) {
+	body := "hello, world"
+	for _, n := range []int{0, 1, 5, len(body), len(body) + 10} {
+		req, _ := NewTestRequest("POST", "http://example.com/", NewHeader(HeaderContentLength, strconv.Itoa(len(body))), []byte(body))
+		p, err := req.PeekBody(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := body
+		if n < len(body) {
+			want = body[:n]
+		}
+		if string(p) != want {
+			t.Errorf("PeekBody(%d) = %q, want %q", n, p, want)
+		}
+		// Peek again with a larger size to extend the buffer.
+		if p, err := req.PeekBody(n + 2); err != nil || len(p) < len(want) || string(p[:len(want)]) != want {
+			t.Errorf("second PeekBody(%d) = %q, %v", n+2, p, err)
+		}
+		all, err := ioutil.ReadAll(req.Body)
+		if err != nil || string(all) != body {
+			t.Errorf("read after PeekBody(%d) = %q, %v, want %q", n, all, err, body)
+		}
+	}
+}
+
+func TestFormValue(t *testing.T) {
+	body := "b=2&c=3&c=4"
+	req, _ := NewTestRequest("POST", "http://example.com/?a=1&c=0", NewHeader(
+		HeaderContentLength, strconv.Itoa(len(body)),
+		HeaderContentType, "application/x-www-form-urlencoded"), []byte(body))
+	if v := req.FormValue("a"); v != "1" {
+		t.Errorf("FormValue(a) = %q, want %q", v, "1")
+	}
+	if v := req.FormValue("b"); v != "2" {
+		t.Errorf("FormValue(b) = %q, want %q", v, "2")
+	}
+	if v := req.FormValues("c"); !reflect.DeepEqual(v, []string{"0", "3", "4"}) {
+		t.Errorf("FormValues(c) = %q, want %q", v, []string{"0", "3", "4"})
+	}
+	// The body is parsed once.
+	if v := req.FormValues("b"); len(v) != 1 {
+		t.Errorf("second FormValues(b) = %q, want one value", v)
+	}
+	if v := req.FormValue("missing"); v != "" {
+		t.Errorf("FormValue(missing) = %q, want empty", v)
+	}
+}
+
+func TestRequestValue(t *testing.T) {
+	// Two packages that use the same name for their private keys.
+	keyA := NewKey("user")
+	keyB := NewKey("user")
+	req, _ := NewTestRequest("GET", "http://example.com/", nil, nil)
+	if v := req.Value(keyA); v != nil {
+		t.Errorf("Value before SetValue = %v, want nil", v)
+	}
+	req.SetValue(keyA, "a")
+	req.SetValue(keyB, 2)
+	req.Env["user"] = "env"
+	if v := req.Value(keyA); v != "a" {
+		t.Errorf("Value(keyA) = %v, want a", v)
+	}
+	if v := req.Value(keyB); v != 2 {
+		t.Errorf("Value(keyB) = %v, want 2", v)
+	}
+	if s := keyA.String(); s != "user" {
+		t.Errorf("String() = %q, want user", s)
+	}
+}
+
+var copyBodyTests = []struct {
+	contentLength bool
+	maxLen        int
+	n             int
+	err           error
+}{
+	{false, 10, 5, nil},
+	{false, 5, 5, nil},
+	{false, 4, 4, ErrRequestEntityTooLarge},
+	{false, -1, 5, nil},
+	{true, 10, 5, nil},
+	{true, 5, 5, nil},
+	{true, 4, 0, ErrRequestEntityTooLarge},
+}
+
+func TestCopyBody(t *testing.T) {
+	body := "hello"
+	for _, tt := range copyBodyTests {
+		var header Header
+		if tt.contentLength {
+			header = NewHeader(HeaderContentLength, strconv.Itoa(len(body)))
+		}
+		req, _ := NewTestRequest("POST", "http://example.com/", header, []byte(body))
+		var buf bytes.Buffer
+		n, err := req.CopyBody(&buf, tt.maxLen)
+		if n != tt.n || err != tt.err || buf.String() != body[:tt.n] {
+			t.Errorf("CopyBody(%d), content length %v = %d, %v, %q, want %d, %v, %q",
+				tt.maxLen, tt.contentLength, n, err, buf.String(), tt.n, tt.err, body[:tt.n])
+		}
+	}
+}
+
+func TestParseFormMethods(t *testing.T) {
+	for _, method := range []string{"POST", "PUT", "PATCH"} {
+		req, _ := NewTestRequest(method, "http://example.com/", NewHeader(
+			HeaderContentLength, "3",
+			HeaderContentType, "application/x-www-form-urlencoded"), []byte("a=1"))
+		if err := req.ParseForm(-1); err != nil || req.Param.Get("a") != "1" {
+			t.Errorf("%s, ParseForm() = %v, param a=%q, want nil, 1", method, err, req.Param.Get("a"))
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// webSocketGUID is the value appended to the client's key when computing the
+// accept key. See RFC 6455, section 1.3.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// webSocketAccept returns the Sec-WebSocket-Accept value for the given
+// Sec-WebSocket-Key value.
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+webSocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hasToken returns true if the comma separated list of tokens in the header
+// with the given key contains token. Tokens are compared case insensitively.
+func hasToken(header Header, key, token string) bool {
+	for _, s := range header.GetList(key) {
+		if strings.EqualFold(s, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradedConn reads data buffered by the server before reading from the
+// hijacked connection.
+type upgradedConn struct {
+	r io.Reader
+	net.Conn
+}
+
+func (c upgradedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// switchProtocols hijacks the connection, writes a 101 response with the
+// given Upgrade header value and extra header lines, and returns the
+// connection.
+func (req *Request) switchProtocols(protocol, extra string) (io.ReadWriteCloser, error) {
+	conn, br, err := req.Responder.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: "+protocol+"\r\n"+
+		"Connection: Upgrade\r\n"+
+		extra+"\r\n")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var r io.Reader = conn
+	if br.Buffered() > 0 {
+		buf, _ := br.Peek(br.Buffered())
+		r = io.MultiReader(bytes.NewReader(buf), conn)
+	}
+	return upgradedConn{r, conn}, nil
+}
+
+// Upgrade switches the connection to the given protocol, for example "h2c"
+// or an application specific protocol. The request's Upgrade header must
+// name the protocol and the Connection header must contain the "upgrade"
+// token. If the request does not ask for the protocol, then Upgrade responds
+// with status 400 and returns a non-nil error.
+//
+// On success, the connection is hijacked from the server, the 101 response
+// is written to the client and the connection is returned along with a
+// buffered reader and writer on the connection. The caller is responsible
+// for flushing the writer and closing the connection.
+func (req *Request) Upgrade(protocol string) (io.ReadWriteCloser, *bufio.ReadWriter, error) {
+	if !hasToken(req.Header, HeaderUpgrade, protocol) || !hasToken(req.Header, HeaderConnection, "upgrade") {
+		err := errors.New("twister: upgrade to " + protocol + " not requested")
+		req.Error(StatusBadRequest, err)
+		return nil, nil, err
+	}
+	conn, err := req.switchProtocols(protocol, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
+
+// UpgradeWebSocket performs the server side of the WebSocket opening
+// handshake specified in RFC 6455. The request must be a GET request with
+// the Upgrade, Connection and Sec-WebSocket-Key headers set. If the request
+// is not a valid handshake, then UpgradeWebSocket responds with an error and
+// returns a non-nil error.
+//
+// On success, the connection is hijacked from the server, the 101 response
+// is written to the client and the connection is returned for frame I/O. The
+// caller is responsible for closing the returned connection.
+func (req *Request) UpgradeWebSocket() (io.ReadWriteCloser, error) {
+	if req.Method != "GET" {
+		req.Error(StatusMethodNotAllowed, errors.New("twister: websocket upgrade requires GET"), HeaderAllow, "GET")
+		return nil, errors.New("twister: bad websocket request method")
+	}
+	if !hasToken(req.Header, HeaderUpgrade, "websocket") || !hasToken(req.Header, HeaderConnection, "upgrade") {
+		err := errors.New("twister: websocket upgrade or connection header missing")
+		req.Error(StatusBadRequest, err)
+		return nil, err
+	}
+	if v := req.Header.Get(HeaderSecWebSocketVersion); v != "13" {
+		err := errors.New("twister: unsupported websocket version")
+		req.Error(StatusBadRequest, err, HeaderSecWebSocketVersion, "13")
+		return nil, err
+	}
+	key := req.Header.Get(HeaderSecWebSocketKey)
+	if p, err := base64.StdEncoding.DecodeString(key); err != nil || len(p) != 16 {
+		err := errors.New("twister: websocket key missing or malformed")
+		req.Error(StatusBadRequest, err)
+		return nil, err
+	}
+
+	return req.switchProtocols("websocket", "Sec-WebSocket-Accept: "+webSocketAccept(key)+"\r\n")
+}
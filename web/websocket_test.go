@@ -0,0 +1,117 @@
+// Copyright 2011 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package web
+
+import (
+	"io"
+	"testing"
+)
+
+func webSocketHeader() Header {
+	return NewHeader(
+		HeaderUpgrade, "websocket",
+		HeaderConnection, "keep-alive, Upgrade",
+		HeaderSecWebSocketVersion, "13",
+		HeaderSecWebSocketKey, "dGhlIHNhbXBsZSBub25jZQ==")
+}
+
+func TestUpgradeWebSocket(t *testing.T) {
+	h := HandlerFunc(func(req *Request) {
+		conn, err := req.UpgradeWebSocket()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		p := make([]byte, 4)
+		if _, err := io.ReadFull(conn, p); err != nil {
+			t.Errorf("read frame, %v", err)
+			return
+		}
+		conn.Write(p)
+	})
+
+	status, _, out := RunHandler("http://example.com/ws", "GET", webSocketHeader(), []byte("ping"), h)
+	if status != 0 {
+		t.Errorf("status=%d, want connection hijacked", status)
+	}
+	expected := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n" +
+		"ping"
+	if string(out) != expected {
+		t.Errorf("out=%q, want %q", out, expected)
+	}
+
+	post := webSocketHeader()
+	status, _, _ = RunHandler("http://example.com/ws", "POST", post, nil, h)
+	if status != StatusMethodNotAllowed {
+		t.Errorf("POST status=%d, want %d", status, StatusMethodNotAllowed)
+	}
+
+	noKey := webSocketHeader()
+	delete(noKey, HeaderSecWebSocketKey)
+	status, _, _ = RunHandler("http://example.com/ws", "GET", noKey, nil, h)
+	if status != StatusBadRequest {
+		t.Errorf("missing key status=%d, want %d", status, StatusBadRequest)
+	}
+
+	noUpgrade := webSocketHeader()
+	delete(noUpgrade, HeaderUpgrade)
+	status, _, _ = RunHandler("http://example.com/ws", "GET", noUpgrade, nil, h)
+	if status != StatusBadRequest {
+		t.Errorf("missing upgrade status=%d, want %d", status, StatusBadRequest)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	h := HandlerFunc(func(req *Request) {
+		conn, rw, err := req.Upgrade("dummy/1.0")
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			t.Errorf("read line, %v", err)
+			return
+		}
+		rw.WriteString("echo " + line)
+		rw.Flush()
+	})
+
+	header := NewHeader(HeaderUpgrade, "Dummy/1.0", HeaderConnection, "Upgrade")
+	status, _, out := RunHandler("http://example.com/dummy", "POST", header, []byte("hello\n"), h)
+	if status != 0 {
+		t.Errorf("status=%d, want connection hijacked", status)
+	}
+	expected := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: dummy/1.0\r\n" +
+		"Connection: Upgrade\r\n\r\n" +
+		"echo hello\n"
+	if string(out) != expected {
+		t.Errorf("out=%q, want %q", out, expected)
+	}
+
+	for _, header := range []Header{
+		NewHeader(HeaderUpgrade, "other", HeaderConnection, "Upgrade"),
+		NewHeader(HeaderUpgrade, "dummy/1.0"),
+	} {
+		status, _, _ = RunHandler("http://example.com/dummy", "GET", header, nil, h)
+		if status != StatusBadRequest {
+			t.Errorf("header %v, status=%d, want %d", header, status, StatusBadRequest)
+		}
+	}
+}